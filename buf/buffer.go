@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,6 +25,9 @@ const SLOP = 128
 
 var nonwdRe = regexp.MustCompile(`\W+`)
 
+// Called for every insertion and deletion, regardless of whether the change was sent to an event channel
+var EventHook func(b *Buffer, origin util.EventOrigin, etype util.EventType, s, e int, text string)
+
 type Buffer struct {
 	Dir           string
 	Name          string
@@ -115,6 +119,11 @@ func NewBuffer(dir, name string, create bool, indentchar string, hl hl.Highlight
 	b.Props["font"] = "main"
 	b.Props["indent"] = "on"
 	b.Props["tab"] = "8"
+	b.Props["wrap"] = "on"
+	if name[0] != '+' {
+		b.Props["linenumbers"] = config.LineNumbers
+		b.Props["ruler"] = strconv.Itoa(config.Ruler)
+	}
 
 	b.EditMarkNext = true
 	b.EditMark = true
@@ -169,7 +178,12 @@ func (b *Buffer) Reload(create bool) error {
 		if isBinary(bytes) {
 			return fmt.Errorf("Can not open binary file")
 		}
-		b.ReplaceFull([]rune(string(bytes)))
+		if b.Size() > 0 {
+			// reloading, keep selections over the parts of the file that didn't change
+			b.ReplaceMinimal([]rune(string(bytes)), &util.Sel{0, b.Size()}, true, nil, 0)
+		} else {
+			b.ReplaceFull([]rune(string(bytes)))
+		}
 
 		b.modTime = fi.ModTime()
 		s1 := sha1.Sum(bytes)
@@ -256,6 +270,63 @@ func (b *Buffer) ReplaceFull(text []rune) {
 	b.restoreSels(saveSels)
 }
 
+// Like Replace but only the lines that changed are replaced, so that selections over the rest of the text are preserved.
+// All changes are a single undo step, if solid is false they are joined to the previous undo step.
+// Returns false if nothing was changed, either because the buffer can't be edited or because text was identical to the contents of sel, sel is only moved after the replacement if something changed.
+func (b *Buffer) ReplaceMinimal(text []rune, sel *util.Sel, solid bool, eventChan chan string, origin util.EventOrigin) bool {
+	if !b.Editable {
+		return false
+	}
+
+	b.FixSel(sel)
+	start := sel.S
+	if start < 0 {
+		start = sel.E
+	}
+	if start < b.EditableStart {
+		sel.S = b.EditableStart
+		sel.E = b.EditableStart
+		return false
+	}
+	oldLines := strings.SplitAfter(string(b.SelectionRunes(util.Sel{start, sel.E})), "\n")
+	newLines := strings.SplitAfter(string(text), "\n")
+	hunks := util.LineDiff(oldLines, newLines)
+
+	starts := make([]int, len(oldLines)+1)
+	starts[0] = start
+	for i := range oldLines {
+		starts[i+1] = starts[i] + utf8.RuneCountInString(oldLines[i])
+	}
+
+	// hunks are applied last to first so that the offsets of the ones before don't change
+	changed := false
+	for i := len(hunks) - 1; i >= 0; i-- {
+		h := hunks[i]
+		hsel := util.Sel{starts[h.A0], starts[h.A1]}
+		oldText := []rune(strings.Join(oldLines[h.A0:h.A1], ""))
+		newText := []rune(strings.Join(newLines[h.B0:h.B1], ""))
+
+		// only replace the part of the lines that changed, selections at the boundary of the hunk would collapse otherwise
+		for len(oldText) > 0 && len(newText) > 0 && oldText[0] == newText[0] {
+			oldText, newText = oldText[1:], newText[1:]
+			hsel.S++
+		}
+		for len(oldText) > 0 && len(newText) > 0 && oldText[len(oldText)-1] == newText[len(newText)-1] {
+			oldText, newText = oldText[:len(oldText)-1], newText[:len(newText)-1]
+			hsel.E--
+		}
+
+		b.Replace(newText, &hsel, solid && !changed, eventChan, origin)
+		changed = true
+	}
+
+	if changed {
+		sel.S = start + len(text)
+		sel.E = sel.S
+	}
+	return changed
+}
+
 // Replaces text between sel.S and sel.E with text, updates sels AND sel accordingly
 // After the replacement the highlighter is restarted
 func (b *Buffer) Replace(text []rune, sel *util.Sel, solid bool, eventChan chan string, origin util.EventOrigin) {
@@ -300,16 +371,21 @@ func (b *Buffer) Replace(text []rune, sel *util.Sel, solid bool, eventChan chan
 }
 
 func (b *Buffer) generateEvent(text []rune, sel util.Sel, eventChan chan string, origin util.EventOrigin) {
-	if eventChan == nil {
-		return
-	}
-
 	if sel.S != sel.E {
-		util.FmteventBase(eventChan, origin, b.Name == "+Tag", util.ET_BODYDEL, sel.S, sel.E, "", func() {})
+		b.event(eventChan, origin, util.ET_BODYDEL, sel.S, sel.E, "")
 	}
 
 	if (sel.S == sel.E) || (len(text) != 0) {
-		util.FmteventBase(eventChan, origin, b.Name == "+Tag", util.ET_BODYINS, sel.S, sel.S, string(text), func() {})
+		b.event(eventChan, origin, util.ET_BODYINS, sel.S, sel.S, string(text))
+	}
+}
+
+func (b *Buffer) event(eventChan chan string, origin util.EventOrigin, etype util.EventType, s, e int, text string) {
+	if eventChan != nil {
+		util.FmteventBase(eventChan, origin, b.Name == "+Tag", etype, s, e, text, func() {})
+	}
+	if EventHook != nil {
+		EventHook(b, origin, etype, s, e, text)
 	}
 }
 
@@ -356,6 +432,8 @@ func (b *Buffer) Undo(sel *util.Sel, redo bool) {
 
 		b.unlock()
 
+		b.generateEvent(text, util.Sel{us.S, us.E}, nil, util.EO_MOUSE)
+
 		sel.S = ws.S
 		sel.E = ws.S + len(text)
 
@@ -845,6 +923,14 @@ func (b *Buffer) Put() error {
 	return nil
 }
 
+// Returns the hex encoded SHA1 checksum of the file as it was last read or written, the empty string if the buffer was never read from or written to disk
+func (b *Buffer) Checksum() string {
+	if b.onDiskChecksum == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", *b.onDiskChecksum)
+}
+
 func (b *Buffer) HasUndo() bool {
 	return b.ul.cur > 0
 }
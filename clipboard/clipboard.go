@@ -1,200 +1,152 @@
 package clipboard
 
 import (
+	"bytes"
 	"fmt"
-	"github.com/BurntSushi/xgb"
-	"github.com/BurntSushi/xgb/xproto"
 	"os"
-	"time"
+	"os/exec"
+	"strings"
+	"sync"
 )
 
-const debugClipboardRequests = false
+// A Backend stores and retrieves the contents of the system clipboard
+type Backend interface {
+	Set(text string)
+	Get() string
+	GetPrimary() string
+}
 
-var X *xgb.Conn
-var win xproto.Window
-var clipboardText string
-var selnotify chan bool
+// maximum number of entries kept in the clipboard history
+var HistorySize = 32
 
-var clipboardAtom, primaryAtom, textAtom, targetsAtom, atomAtom xproto.Atom
-var targetAtoms []xproto.Atom
-var clipboardAtomCache = map[xproto.Atom]string{}
+var history []string
+var historyMu sync.Mutex
 
-func Start() {
-	var err error
-	X, err = xgb.NewConnDisplay("")
-	if err != nil {
-		panic(err)
-	}
+var backend Backend = &memoryBackend{}
 
-	selnotify = make(chan bool, 1)
+// Commands used by the "cmd" backend, the text to copy is written to the standard input of CopyCmd, the clipboard contents are read from the standard output of PasteCmd and PastePrimaryCmd
+var CopyCmd = "wl-copy"
+var PasteCmd = "wl-paste -n"
+var PastePrimaryCmd = "wl-paste -n -p"
 
-	win, err = xproto.NewWindowId(X)
-	if err != nil {
-		panic(err)
-	}
-
-	setup := xproto.Setup(X)
-	s := setup.DefaultScreen(X)
-	err = xproto.CreateWindowChecked(X, s.RootDepth, win, s.Root, 100, 100, 1, 1, 0, xproto.WindowClassInputOutput, s.RootVisual, 0, []uint32{}).Check()
-	if err != nil {
-		panic(err)
+// Initializes the clipboard using the named backend: x11 uses the X11 CLIPBOARD and PRIMARY selections, memory keeps the clipboard inside this process, cmd delegates to the external commands CopyCmd, PasteCmd and PastePrimaryCmd.
+// If name is the empty string x11 is used when a display is available, memory otherwise.
+func Start(name string) error {
+	switch name {
+	case "":
+		if os.Getenv("DISPLAY") == "" {
+			backend = &memoryBackend{}
+			return nil
+		}
+		fallthrough
+	case "x11":
+		b, err := startX11()
+		if err != nil {
+			return err
+		}
+		backend = b
+	case "memory":
+		backend = &memoryBackend{}
+	case "cmd":
+		backend = &cmdBackend{}
+	default:
+		return fmt.Errorf("unknown clipboard backend %q", name)
 	}
+	return nil
+}
 
-	clipboardAtom = internAtom(X, "CLIPBOARD")
-	primaryAtom = internAtom(X, "PRIMARY")
-	textAtom = internAtom(X, "UTF8_STRING")
-	targetsAtom = internAtom(X, "TARGETS")
-	atomAtom = internAtom(X, "ATOM")
+func Set(text string) {
+	historyPush(text)
+	backend.Set(text)
+}
 
-	targetAtoms = []xproto.Atom{targetsAtom, textAtom}
+func Get() string {
+	return backend.Get()
+}
 
-	go eventLoop()
+func GetPrimary() string {
+	return backend.GetPrimary()
 }
 
-func Set(text string) {
-	clipboardText = text
-	ssoc := xproto.SetSelectionOwnerChecked(X, win, clipboardAtom, xproto.TimeCurrentTime)
-	if err := ssoc.Check(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error setting clipboard: %v", err)
+func historyPush(text string) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for i := range history {
+		if history[i] == text {
+			history = append(history[:i], history[i+1:]...)
+			break
+		}
 	}
-	ssoc = xproto.SetSelectionOwnerChecked(X, win, primaryAtom, xproto.TimeCurrentTime)
-	if err := ssoc.Check(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error setting primary selection: %v", err)
+	history = append([]string{text}, history...)
+	if len(history) > HistorySize {
+		history = history[:HistorySize]
 	}
 }
 
-func Get() string {
-	return getSelection(clipboardAtom)
+// Returns the texts passed to Set, most recent first
+func History() []string {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	r := make([]string, len(history))
+	copy(r, history)
+	return r
 }
 
-func GetPrimary() string {
-	return getSelection(primaryAtom)
+// Clipboard backend that keeps the clipboard in memory
+type memoryBackend struct {
+	mu   sync.Mutex
+	text string
 }
 
-func getSelection(selAtom xproto.Atom) string {
-	csc := xproto.ConvertSelectionChecked(X, win, selAtom, textAtom, selAtom, xproto.TimeCurrentTime)
-	err := csc.Check()
-	if err != nil {
-		fmt.Println(err)
-		return ""
-	}
+func (b *memoryBackend) Set(text string) {
+	b.mu.Lock()
+	b.text = text
+	b.mu.Unlock()
+}
 
-	select {
-	case r := <-selnotify:
-		if !r {
-			return ""
-		}
-		gpc := xproto.GetProperty(X, true, win, selAtom, textAtom, 0, 5*1024*1024)
-		gpr, err := gpc.Reply()
-		if err != nil {
-			fmt.Println(err)
-			return ""
-		}
-		if gpr.BytesAfter != 0 {
-			fmt.Println("Clipboard too large")
-			return ""
-		}
-		return string(gpr.Value[:gpr.ValueLen])
-	case <-time.After(1 * time.Second):
-		fmt.Println("Clipboard retrieval failed, timeout")
-		return ""
-	}
+func (b *memoryBackend) Get() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.text
 }
 
-func eventLoop() {
-	for {
-		e, err := X.WaitForEvent()
-		if err != nil {
-			continue
-		}
+func (b *memoryBackend) GetPrimary() string {
+	return b.Get()
+}
 
-		switch e := e.(type) {
-		case xproto.SelectionRequestEvent:
-			if debugClipboardRequests {
-				tgtname := lookupAtom(e.Target)
-				propname := lookupAtom(e.Property)
-				fmt.Println("SelectionRequest", e, textAtom, tgtname, propname, "isPrimary:", e.Selection == primaryAtom, "isClipboard:", e.Selection == clipboardAtom)
-			}
-			t := clipboardText
-
-			switch e.Target {
-			case textAtom:
-				if debugClipboardRequests {
-					fmt.Println("Sending as text")
-				}
-				cpc := xproto.ChangePropertyChecked(X, xproto.PropModeReplace, e.Requestor, e.Property, textAtom, 8, uint32(len(t)), []byte(t))
-				err := cpc.Check()
-				if err == nil {
-					sendSelectionNotify(e)
-				} else {
-					fmt.Println(err)
-				}
-
-			case targetsAtom:
-				if debugClipboardRequests {
-					fmt.Println("Sending targets")
-				}
-				buf := make([]byte, len(targetAtoms)*4)
-				for i, atom := range targetAtoms {
-					xgb.Put32(buf[i*4:], uint32(atom))
-				}
-
-				xproto.ChangePropertyChecked(X, xproto.PropModeReplace, e.Requestor, e.Property, atomAtom, 32, uint32(len(targetAtoms)), buf).Check()
-				if err == nil {
-					sendSelectionNotify(e)
-				} else {
-					fmt.Println(err)
-				}
-
-			default:
-				if debugClipboardRequests {
-					fmt.Println("Skipping")
-				}
-				e.Property = 0
-				sendSelectionNotify(e)
-			}
-
-		case xproto.SelectionNotifyEvent:
-			selnotify <- (e.Property == clipboardAtom) || (e.Property == primaryAtom)
-		}
-	}
+// Clipboard backend that runs external commands, if they fail the clipboard is kept in memory
+type cmdBackend struct {
+	memoryBackend
 }
 
-func lookupAtom(at xproto.Atom) string {
-	if s, ok := clipboardAtomCache[at]; ok {
-		return s
+func (b *cmdBackend) Set(text string) {
+	b.memoryBackend.Set(text)
+	cmd := exec.Command("/bin/sh", "-c", CopyCmd)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = os.Stderr
+	// commands like wl-copy fork a process that stays around to serve the clipboard, don't wait for it
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error setting clipboard: %v\n", err)
+		return
 	}
+	go cmd.Wait()
+}
 
-	reply, err := xproto.GetAtomName(X, at).Reply()
-	if err != nil {
-		panic(err)
-	}
+func (b *cmdBackend) Get() string {
+	return b.run(PasteCmd)
+}
 
-	// If we're here, it means we didn't have ths ATOM id cached. So cache it.
-	atomName := string(reply.Name)
-	clipboardAtomCache[at] = atomName
-	return atomName
-}
-
-func sendSelectionNotify(e xproto.SelectionRequestEvent) {
-	sn := xproto.SelectionNotifyEvent{
-		Time:      e.Time,
-		Requestor: e.Requestor,
-		Selection: e.Selection,
-		Target:    e.Target,
-		Property:  e.Property}
-	sec := xproto.SendEventChecked(X, false, e.Requestor, 0, string(sn.Bytes()))
-	err := sec.Check()
-	if err != nil {
-		fmt.Println(err)
-	}
+func (b *cmdBackend) GetPrimary() string {
+	return b.run(PastePrimaryCmd)
 }
 
-func internAtom(conn *xgb.Conn, n string) xproto.Atom {
-	iac := xproto.InternAtom(conn, true, uint16(len(n)), n)
-	iar, err := iac.Reply()
-	if err != nil {
-		panic(err)
+func (b *cmdBackend) run(pastecmd string) string {
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", pastecmd)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading clipboard: %v\n", err)
+		return b.memoryBackend.Get()
 	}
-	return iar.Atom
+	return out.String()
 }
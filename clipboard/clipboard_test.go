@@ -0,0 +1,91 @@
+package clipboard
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryBackend(t *testing.T) {
+	if err := Start("memory"); err != nil {
+		t.Fatal(err)
+	}
+	if s := Get(); s != "" {
+		t.Errorf("clipboard not empty: %q", s)
+	}
+	Set("first")
+	if s := Get(); s != "first" {
+		t.Errorf("wrong clipboard %q", s)
+	}
+	if s := GetPrimary(); s != "first" {
+		t.Errorf("wrong primary selection %q", s)
+	}
+}
+
+func TestCmdBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "yacco-clipboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "clipboard")
+
+	oldCopy, oldPaste, oldPastePrimary := CopyCmd, PasteCmd, PastePrimaryCmd
+	defer func() { CopyCmd, PasteCmd, PastePrimaryCmd = oldCopy, oldPaste, oldPastePrimary }()
+	CopyCmd = "cat > " + path
+	PasteCmd = "cat " + path
+	PastePrimaryCmd = "false"
+
+	if err := Start("cmd"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copy command isn't waited for
+	Set("copied\ntext")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if bs, _ := ioutil.ReadFile(path); string(bs) == "copied\ntext" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("copy command not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ioutil.WriteFile(path, []byte("pasted"), 0600)
+	if s := Get(); s != "pasted" {
+		t.Errorf("wrong clipboard %q", s)
+	}
+
+	// failing commands fall back to the text kept in memory
+	if s := GetPrimary(); s != "copied\ntext" {
+		t.Errorf("wrong primary selection %q", s)
+	}
+}
+
+func TestStartUnknown(t *testing.T) {
+	if err := Start("nonexistent"); err == nil {
+		t.Errorf("unknown backend accepted")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	oldSize := HistorySize
+	defer func() {
+		HistorySize = oldSize
+		history = nil
+	}()
+	HistorySize = 3
+	history = nil
+
+	for _, s := range []string{"a", "b", "c", "b", "d"} {
+		historyPush(s)
+	}
+	if h := History(); !reflect.DeepEqual(h, []string{"d", "b", "c"}) {
+		t.Errorf("wrong history %q", h)
+	}
+}
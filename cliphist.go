@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/clipboard"
+	"github.com/aarzilli/yacco/util"
+)
+
+const clipboardEntryMaxLen = 70
+
+// position of the text inserted by the last paste, used by Paste Cycle to replace it with an earlier entry of the clipboard history
+var lastPaste struct {
+	buf *buf.Buffer
+	sel util.Sel
+	rev int
+	idx int // index in the clipboard history of the pasted text, -1 if unknown
+}
+
+func clipboardSet(s string) {
+	clipboard.Set(s)
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			if ed.bodybuf.Name == "+Clipboard" {
+				clipboardList(ed)
+			}
+		}
+	}
+}
+
+// Records the text inserted by a paste that started at start
+func pasteDone(ec ExecContext, start, idx int) {
+	lastPaste.buf = ec.buf
+	lastPaste.sel = util.Sel{start, ec.fr.Sel.S}
+	lastPaste.rev = ec.buf.RevCount
+	lastPaste.idx = idx
+}
+
+func pasteHistory(ec ExecContext, idx int) {
+	h := clipboard.History()
+	if idx < 0 || idx >= len(h) {
+		return
+	}
+	start := ec.fr.Sel.S
+	ec.buf.Replace([]rune(h[idx]), &ec.fr.Sel, true, ec.eventChan, util.EO_MOUSE)
+	pasteDone(ec, start, idx)
+	if !ec.norefresh {
+		ec.br()
+	}
+}
+
+// Replaces the text inserted by the last paste with the next entry of the clipboard history
+func pasteCycle(ec ExecContext) {
+	h := clipboard.History()
+	if len(h) == 0 {
+		return
+	}
+
+	if lastPaste.buf != ec.buf || lastPaste.rev != ec.buf.RevCount || ec.fr.Sel != (util.Sel{lastPaste.sel.E, lastPaste.sel.E}) {
+		// the last command wasn't a paste, start from the most recent entry
+		pasteHistory(ec, 0)
+		return
+	}
+
+	cur := string(ec.buf.SelectionRunes(lastPaste.sel))
+	idx := lastPaste.idx
+	for range h {
+		idx = (idx + 1) % len(h)
+		if h[idx] != cur {
+			break
+		}
+	}
+
+	ec.fr.Sel = lastPaste.sel
+	pasteHistory(ec, idx)
+}
+
+func clipboardList(ed *Editor) {
+	t := ""
+	for i, s := range clipboard.History() {
+		lines := strings.Split(s, "\n")
+		first := []rune(lines[0])
+		if len(first) > clipboardEntryMaxLen {
+			first = append(first[:clipboardEntryMaxLen], '…')
+		}
+		if len(lines) > 1 {
+			t += fmt.Sprintf("Paste %d\t%s\t(+%d lines)\n", i+1, string(first), len(lines)-1)
+		} else {
+			t += fmt.Sprintf("Paste %d\t%s\n", i+1, string(first))
+		}
+	}
+
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(t), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+}
+
+func ClipboardCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	wd, _ := os.Getwd()
+	ed, err := EditFind(wd, "+Clipboard", false, true)
+	if err != nil {
+		Warn("Clipboard: " + err.Error())
+		return
+	}
+	clipboardList(ed)
+}
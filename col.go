@@ -27,6 +27,13 @@ type Col struct {
 	tagbuf *buf.Buffer
 
 	closeRequested time.Time
+
+	stacked bool       // only one editor is shown, the others are listed in the tag
+	cur     *Editor    // editor shown when stacked
+	tabs    []util.Sel // position of the name of each editor in the tag, when stacked
+
+	maximized       *Editor         // editor maximized by Maximize
+	unmaximizedSize map[*Editor]int // sizes of the editors before Maximize
 }
 
 func NewCol(wnd *Window, r image.Rectangle) *Col {
@@ -95,13 +102,7 @@ func (c *Col) AddAfter(ed *Editor, n int, y int, wobble bool) {
 		}
 
 		if wobble {
-			if mh := ed.MinHeight(); ed.size < mh {
-				ed.size = mh
-			}
-
-			if mh := c.editors[n].MinHeight(); c.editors[n].size < mh {
-				c.editors[n].size = mh
-			}
+			ensureMinHeight(ed, c.editors[n])
 		}
 
 		c.editors = append(c.editors, nil)
@@ -109,10 +110,44 @@ func (c *Col) AddAfter(ed *Editor, n int, y int, wobble bool) {
 		c.editors[n+1] = ed
 	}
 
+	if c.stacked {
+		c.cur = ed
+	}
+
+	c.RecalcRects(c.last)
+	c.Redraw()
+}
+
+// Adds ed at the top of the column, taking half of the space of the first editor
+func (c *Col) AddFirst(ed *Editor) {
+	if len(c.editors) == 0 {
+		c.AddAfter(ed, -1, -1, true)
+		return
+	}
+
+	ed.SetWnd(c.wnd)
+	ed.size = c.editors[0].size / 2
+	c.editors[0].size -= ed.size
+	ensureMinHeight(ed, c.editors[0])
+
+	c.editors = append([]*Editor{ed}, c.editors...)
+
+	if c.stacked {
+		c.cur = ed
+	}
+
 	c.RecalcRects(c.last)
 	c.Redraw()
 }
 
+func ensureMinHeight(eds ...*Editor) {
+	for _, ed := range eds {
+		if mh := ed.MinHeight(); ed.size < mh {
+			ed.size = mh
+		}
+	}
+}
+
 func (c *Col) sumEditorsHeight() int {
 	sz := 0
 	for i := range c.editors {
@@ -139,10 +174,17 @@ func (c *Col) RecalcRects(last bool) {
 	c.tagfr.R.Max.Y = c.tagfr.R.Min.Y + TagHeight(&c.tagfr)
 	c.tagfr.R = screen.Bounds().Intersect(c.tagfr.R)
 	c.tagfr.B = screen
+	c.genTag()
 	c.tagfr.Clear()
 	c.tagfr.Insert(c.tagbuf.Selection(util.Sel{0, c.tagbuf.Size()}))
 
 	h := c.contentArea()
+
+	if c.stacked {
+		c.recalcStacked(h)
+		return
+	}
+
 	oldh := c.sumEditorsHeight()
 
 	if h != oldh {
@@ -241,6 +283,9 @@ func (c *Col) Redraw() {
 	c.tagfr.Redraw(false, nil)
 
 	for i, _ := range c.editors {
+		if c.stacked && c.editors[i] != c.cur {
+			continue
+		}
 		c.editors[i].Redraw()
 	}
 }
@@ -275,6 +320,10 @@ func (c *Col) Remove(i int) *Editor {
 		ned.size += c.editors[i].size
 	}
 
+	if c.cur == c.editors[i] {
+		c.cur = ned
+	}
+
 	copy(c.editors[i:], c.editors[i+1:])
 	c.editors = c.editors[:len(c.editors)-1]
 
@@ -297,7 +346,7 @@ func (c *Col) Dump(buffers map[string]int) DumpColumn {
 	for i := range c.editors {
 		editors[i] = c.editors[i].Dump(buffers, c.contentArea())
 	}
-	return DumpColumn{c.frac, editors, string(c.tagbuf.SelectionRunes(util.Sel{0, c.tagbuf.Size()}))}
+	return DumpColumn{c.frac, editors, c.tagUserText(), c.stacked}
 }
 
 func (c *Col) Width() int {
@@ -307,3 +356,149 @@ func (c *Col) Width() int {
 func (c *Col) PropTrigger() {
 	c.tagfr.Font = config.MainFont
 }
+
+// Gives all the height of the column to the editor shown, the other editors get an empty rectangle and aren't drawn
+func (c *Col) recalcStacked(h int) {
+	screen := c.b
+	cur := c.stackCurrent()
+
+	r := c.r
+	r.Min.Y = c.r.Min.Y + TagHeight(&c.tagfr) + 2
+	r.Max.Y = r.Min.Y + h
+	hidden := r
+	hidden.Max.Y = hidden.Min.Y
+
+	for _, ed := range c.editors {
+		if ed == cur {
+			ed.size = h
+			ed.SetRects(screen, c.r.Intersect(r), c.last, false)
+		} else {
+			ed.size = 0
+			ed.SetRects(screen, hidden, c.last, false)
+		}
+	}
+}
+
+// Returns the editor shown by a stacked column
+func (c *Col) stackCurrent() *Editor {
+	if c.IndexOf(c.cur) < 0 {
+		c.cur = nil
+		if len(c.editors) > 0 {
+			c.cur = c.editors[0]
+		}
+	}
+	return c.cur
+}
+
+func (c *Col) SetStacked(stacked bool) {
+	if c.stacked == stacked {
+		return
+	}
+	c.stacked = stacked
+	if stacked {
+		c.cur = nil
+		if activeEditor != nil && c.IndexOf(activeEditor) >= 0 {
+			c.cur = activeEditor
+		}
+	} else {
+		c.equalizeEditors()
+	}
+	c.RecalcRects(c.last)
+	c.Redraw()
+	c.wnd.FlushImage(c.r)
+}
+
+// Shows ed, if the column is stacked
+func (c *Col) stackShow(ed *Editor) {
+	if !c.stacked || c.cur == ed {
+		return
+	}
+	c.cur = ed
+	c.RecalcRects(c.last)
+	c.Redraw()
+	c.wnd.FlushImage(c.r)
+}
+
+// Gives the same height to all editors
+func (c *Col) equalizeEditors() {
+	if len(c.editors) == 0 {
+		return
+	}
+	h := c.contentArea()
+	for _, ed := range c.editors {
+		ed.size = h / len(c.editors)
+	}
+	c.editors[len(c.editors)-1].size += h % len(c.editors)
+}
+
+// Returns the editor whose tab is at position p of the tag
+func (c *Col) tabAt(p int) *Editor {
+	for i, tab := range c.tabs {
+		if p >= tab.S && p <= tab.E && i < len(c.editors) {
+			return c.editors[i]
+		}
+	}
+	return nil
+}
+
+func (c *Col) tagUserText() string {
+	s := 0
+	if c.tagbuf.EditableStart >= 0 {
+		s = c.tagbuf.EditableStart
+	}
+	return string(c.tagbuf.SelectionRunes(util.Sel{s, c.tagbuf.Size()}))
+}
+
+// When the column is stacked lists the editors before the text of the tag, the name of the editor shown is between brackets
+func (c *Col) genTag() {
+	usertext := c.tagUserText()
+	c.tabs = c.tabs[:0]
+
+	t := []rune{}
+	if c.stacked {
+		cur := c.stackCurrent()
+		for i, ed := range c.editors {
+			if i > 0 {
+				t = append(t, ' ')
+			}
+			name := ed.bodybuf.Name
+			if ed == cur {
+				name = "[" + name + "]"
+			}
+			c.tabs = append(c.tabs, util.Sel{len(t), len(t) + len([]rune(name))})
+			t = append(t, []rune(name)...)
+		}
+		t = append(t, []rune(" | ")...)
+	} else if c.tagbuf.EditableStart < 0 {
+		return
+	}
+
+	editableStart := -1
+	if c.stacked {
+		editableStart = len(t)
+	}
+	t = append(t, []rune(usertext)...)
+	if string(t) == string(c.tagbuf.SelectionRunes(util.Sel{0, c.tagbuf.Size()})) {
+		return
+	}
+
+	// the selection is kept in the same place relative to the text of the user
+	off := c.tagbuf.EditableStart
+	if off < 0 {
+		off = 0
+	}
+	start, end := 0, 0
+	if c.tagfr.Sel.S >= off {
+		start, end = c.tagfr.Sel.S-off, c.tagfr.Sel.E-off
+	}
+	c.tagbuf.EditableStart = -1
+	c.tagbuf.Replace(t, &util.Sel{0, c.tagbuf.Size()}, true, nil, 0)
+	c.tagbuf.FlushUndo()
+	c.tagbuf.EditableStart = editableStart
+	if editableStart > 0 {
+		start += editableStart
+		end += editableStart
+	}
+	c.tagfr.Sel = util.Sel{start, end}
+	c.tagbuf.FixSel(&c.tagfr.Sel)
+}
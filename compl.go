@@ -29,6 +29,9 @@ var tooltipContents string
 var Compl, Tooltip Popup
 var complPrefixSuffix string
 
+// snippet inserted by Tab, set when it is the only completion
+var complSnippet *util.Template
+
 func init() {
 	Compl.start = complStart
 	Tooltip.start = tooltipStart
@@ -195,8 +198,24 @@ func complStart(p *Popup, ec ExecContext) (bool, string) {
 	compls = util.Dedup(append(compls, wdCompls...))
 
 	templCompl := []string{}
+	complSnippet = nil
 	if templwd != "" {
-		complFilter(templwd, config.Templates, &templCompl)
+		vars := snippetVars(ec.buf, "")
+		texts := []string{}
+		snippets := map[string]util.Template{}
+		for _, tmpl := range config.TemplatesFor(filepath.Join(ec.buf.Dir, ec.buf.Name)) {
+			txt, _ := tmpl.Expand("", vars)
+			if tmpl.Snippet {
+				snippets[txt] = tmpl
+			}
+			texts = append(texts, txt)
+		}
+		complFilter(templwd, texts, &templCompl)
+		if len(templCompl) == 1 {
+			if tmpl, ok := snippets[templCompl[0]]; ok {
+				complSnippet = &tmpl
+			}
+		}
 	}
 	for i := range templCompl {
 		templCompl[i] = strings.Replace(templCompl[i], "\n", "\n"+templind, -1)
@@ -208,6 +227,9 @@ func complStart(p *Popup, ec ExecContext) (bool, string) {
 		HideCompl(false)
 		return false, ""
 	}
+	if len(compls) != 1 {
+		complSnippet = nil
+	}
 
 	initialized := false
 	if hasFp {
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"regexp"
+
 	"github.com/aarzilli/yacco/hl"
 	"github.com/aarzilli/yacco/util"
 
@@ -30,12 +32,44 @@ var HideHidden = true
 
 var FontSizeChange = 0
 
-var Templates []string
+const DefaultHistoryFile = "$HOME/longhistory"
+
+var HistoryFile = DefaultHistoryFile
+
+// seconds between autosaves of modified buffers, 0 disables autosave
+const DefaultAutosaveInterval = 30
+
+var AutosaveInterval = DefaultAutosaveInterval
+
+// default values of the linenumbers (off, on or relative) and ruler properties of buffers
+var LineNumbers = "off"
+var Ruler = 0
+
+// clipboard backend (x11, memory or cmd, empty to autodetect) and commands used by the cmd backend
+var ClipboardBackend = ""
+var ClipboardCopyCmd = ""
+var ClipboardPasteCmd = ""
+var ClipboardPastePrimaryCmd = ""
+
+var Templates []util.Template
+
+// templates used only for some buffers, see TemplatesFor
+var TemplateFiles = []util.TemplateFile{}
+var LanguageTemplates = []LanguageTemplate{}
+
+type LanguageTemplate struct {
+	BufRe     *regexp.Regexp
+	Templates []util.Template
+}
 
 const DefaultLookFileExt = ",c,cc,cpp,h,py,txt,pl,tcl,java,js,html,go,clj,jsp"
 
 var LoadRules = []util.LoadRule{}
 
+var SaveHooks = []util.SaveHook{}
+
+var PlacementRules = []util.PlacementRule{}
+
 var LanguageRules = []hl.LanguageRules{
 	// Go
 	hl.LanguageRules{
@@ -50,14 +84,32 @@ var LanguageRules = []hl.LanguageRules{
 		},
 	},
 
-	// C / C++ / Java / js
+	// C / C++
+	hl.LanguageRules{
+		NameRe: `\.(?:c|cpp|h)$`,
+		RegionMatches: []hl.RegionMatch{
+			hl.StringRegion("\"", "\"", '\\'),
+			hl.StringRegion("'", "'", '\\'),
+			hl.CommentRegion("/*", "*/", 0),
+			hl.CommentRegion("//", "\n", 0),
+			hl.RegexpRegion(`^\s*(class|enum|struct|union)\s+`, `\W`, 0, hl.RMT_HEADER),
+			// functions, their return type starts at the beginning of the line
+			hl.RegexpRegion(`^\w[\w \t:<>,]*[ \t\*&]+`, `\W`, 0, hl.RMT_HEADER),
+		},
+	},
+
+	// Java / js
 	hl.LanguageRules{
-		NameRe: `\.(?:c|java|cpp|h|js)$`,
+		NameRe: `\.(?:java|js)$`,
 		RegionMatches: []hl.RegionMatch{
 			hl.StringRegion("\"", "\"", '\\'),
 			hl.StringRegion("'", "'", '\\'),
 			hl.CommentRegion("/*", "*/", 0),
 			hl.CommentRegion("//", "\n", 0),
+			hl.RegexpRegion(`^\s*((public|private|protected|static|abstract|final|export|default)\s+)*(class|interface|enum)\s+`, `\W`, 0, hl.RMT_HEADER),
+			hl.RegexpRegion(`^\s*((export|default|async)\s+)*function\*?\s+`, `\W`, 0, hl.RMT_HEADER),
+			// methods
+			hl.RegexpRegion(`^[ \t]+(public|private|protected)[ \t]+([\w<>\[\],]+[ \t]+)+`, `\W`, 0, hl.RMT_HEADER),
 		},
 	},
 
@@ -69,6 +121,7 @@ var LanguageRules = []hl.LanguageRules{
 			hl.StringRegion("\"", "\"", '\\'),
 			hl.StringRegion("'", "'", '\\'),
 			hl.CommentRegion("#", "\n", 0),
+			hl.RegexpRegion(`^\s*(async\s+)?(def|class)\s+`, `\W`, 0, hl.RMT_HEADER),
 		},
 	},
 
@@ -78,6 +131,15 @@ var LanguageRules = []hl.LanguageRules{
 			hl.StringRegion("\"", "\"", '\\'),
 			hl.StringRegion("'", "'", '\\'),
 			hl.CommentRegion("--", "\n", 0),
+			hl.RegexpRegion(`^\s*(local\s+)?function\s+`, `[^\w\.:]`, 0, hl.RMT_HEADER),
+		},
+	},
+
+	// Markdown
+	hl.LanguageRules{
+		NameRe: `\.md$`,
+		RegionMatches: []hl.RegionMatch{
+			hl.RegexpRegion(`^#+[ \t]*`, `\n`, 0, hl.RMT_HEADER),
 		},
 	},
 }
@@ -43,12 +43,13 @@ var KeyBindings = map[string]string{
 	"end":                 END_CMD,
 	"control+e":           END_CMD,
 
-	"control+c": "Copy",
-	"control+v": "Paste Indent",
-	"control+y": "Paste Primary",
-	"control+x": "Cut",
-	"control+s": "Put",
-	"control+k": "Edit -0-#0+0 c//",
+	"control+c":       "Copy",
+	"control+v":       "Paste Indent",
+	"control+shift+v": "Paste Cycle",
+	"control+y":       "Paste Primary",
+	"control+x":       "Cut",
+	"control+s":       "Put",
+	"control+k":       "Edit -0-#0+0 c//",
 
 	"control+z":       "Undo",
 	"control+shift+z": "Redo",
@@ -67,6 +68,9 @@ var KeyBindings = map[string]string{
 	"control+-": "Font -",
 
 	"control+n": "NextError",
+
+	"alt+left_arrow":  "Back",
+	"alt+right_arrow": "Forward",
 }
 
 var KeyConversion = map[string]key.Event{
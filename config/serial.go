@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,10 +25,22 @@ type configObj struct {
 		LookFileExt        string
 		LookFileSkip       string
 		LookFileDepth      int
+		HistoryFile        string
+		AutosaveInterval   int
+		LineNumbers        string
+		Ruler              int
+
+		Clipboard                string
+		ClipboardCopyCmd         string
+		ClipboardPasteCmd        string
+		ClipboardPastePrimaryCmd string
 	}
 	Fonts       map[string]*configFont
 	Load        *configLoadRules
 	KeyBindings *configKeys
+	Hooks       *configHooks
+	Templates   *configTemplates
+	Placement   *configPlacement
 }
 
 var admissibleFonts = []string{"Main", "Tag", "Alt", "Compl"}
@@ -45,6 +58,18 @@ type configLoadRules struct {
 	loadRules []util.LoadRule
 }
 
+type configHooks struct {
+	hooks []util.SaveHook
+}
+
+type configTemplates struct {
+	files []util.TemplateFile
+}
+
+type configPlacement struct {
+	rules []util.PlacementRule
+}
+
 type configKeys struct {
 	keys map[string]string
 }
@@ -80,11 +105,17 @@ func LoadConfiguration(path string) {
 
 	co.Core.LookFileExt = DefaultLookFileExt
 	co.Core.LookFileDepth = -1
+	co.Core.HistoryFile = DefaultHistoryFile
+	co.Core.AutosaveInterval = DefaultAutosaveInterval
+	co.Core.LineNumbers = LineNumbers
 
 	u := iniparse.NewUnmarshaller()
 	u.Path = path
 	u.AddSpecialUnmarshaller("load", LoadRulesParser)
 	u.AddSpecialUnmarshaller("keybindings", LoadKeysParser)
+	u.AddSpecialUnmarshaller("hooks", LoadHooksParser)
+	u.AddSpecialUnmarshaller("templates", LoadTemplatesParser)
+	u.AddSpecialUnmarshaller("placement", LoadPlacementParser)
 
 	fh, err := os.Open(path)
 	if err != nil {
@@ -117,6 +148,18 @@ func LoadConfiguration(path string) {
 		LoadRules = co.Load.loadRules
 	}
 
+	if co.Hooks != nil {
+		SaveHooks = co.Hooks.hooks
+	}
+
+	if co.Templates != nil {
+		TemplateFiles = co.Templates.files
+	}
+
+	if co.Placement != nil {
+		PlacementRules = co.Placement.rules
+	}
+
 	if co.KeyBindings != nil {
 		for k, v := range co.KeyBindings.keys {
 			KeyBindings[k] = v
@@ -131,6 +174,14 @@ func LoadConfiguration(path string) {
 	EnableHighlighting = co.Core.EnableHighlighting
 	ServeTCP = co.Core.ServeTCP
 	HideHidden = co.Core.HideHidden
+	HistoryFile = co.Core.HistoryFile
+	AutosaveInterval = co.Core.AutosaveInterval
+	LineNumbers = co.Core.LineNumbers
+	Ruler = co.Core.Ruler
+	ClipboardBackend = co.Core.Clipboard
+	ClipboardCopyCmd = co.Core.ClipboardCopyCmd
+	ClipboardPasteCmd = co.Core.ClipboardPasteCmd
+	ClipboardPastePrimaryCmd = co.Core.ClipboardPastePrimaryCmd
 
 	os.Setenv("LOOKFILE_EXT", co.Core.LookFileExt)
 	os.Setenv("LOOKFILE_SKIP", co.Core.LookFileSkip)
@@ -150,6 +201,9 @@ func ReloadFonts(path string) {
 	u.Path = path
 	u.AddSpecialUnmarshaller("load", LoadRulesParser)
 	u.AddSpecialUnmarshaller("keybindings", LoadKeysParser)
+	u.AddSpecialUnmarshaller("hooks", LoadHooksParser)
+	u.AddSpecialUnmarshaller("templates", LoadTemplatesParser)
+	u.AddSpecialUnmarshaller("placement", LoadPlacementParser)
 
 	fh, err := os.Open(path)
 	if err != nil {
@@ -217,6 +271,82 @@ func LoadRulesParser(path string, lineno int, lines []string) (interface{}, erro
 	return r, nil
 }
 
+func LoadHooksParser(path string, lineno int, lines []string) (interface{}, error) {
+	r := &configHooks{make([]util.SaveHook, 0, len(lines))}
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		v := strings.SplitN(line, "\t", 3)
+		if len(v) != 3 {
+			return nil, fmt.Errorf("%s:%d: Malformed line", path, lineno+i)
+		}
+		if v[1] != "fmt" && v[1] != "lint" {
+			return nil, fmt.Errorf("%s:%d: Unknown hook kind %q", path, lineno+i, v[1])
+		}
+		r.hooks = append(r.hooks, util.SaveHook{BufRe: v[0], Kind: v[1], Cmd: v[2]})
+	}
+	return r, nil
+}
+
+func LoadTemplatesParser(path string, lineno int, lines []string) (interface{}, error) {
+	r := &configTemplates{make([]util.TemplateFile, 0, len(lines))}
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		v := strings.Split(line, "\t")
+		if len(v) != 2 {
+			return nil, fmt.Errorf("%s:%d: Malformed line", path, lineno+i)
+		}
+		r.files = append(r.files, util.TemplateFile{BufRe: v[0], Path: v[1]})
+	}
+	return r, nil
+}
+
+func LoadPlacementParser(path string, lineno int, lines []string) (interface{}, error) {
+	r := &configPlacement{make([]util.PlacementRule, 0, len(lines))}
+	for i := range lines {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		if line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		v := strings.Split(line, "\t")
+		if len(v) != 2 && len(v) != 3 {
+			return nil, fmt.Errorf("%s:%d: Malformed line", path, lineno+i)
+		}
+		rule := util.PlacementRule{BufRe: v[0], Column: v[1]}
+		if len(v) == 3 {
+			rule.Position = v[2]
+		}
+		switch rule.Column {
+		case "first", "last":
+		default:
+			if _, err := strconv.Atoi(rule.Column); err != nil && !strings.HasPrefix(rule.Column, "beside ") {
+				return nil, fmt.Errorf("%s:%d: Unknown column %q", path, lineno+i, rule.Column)
+			}
+		}
+		switch rule.Position {
+		case "", "auto", "top", "bottom":
+		default:
+			return nil, fmt.Errorf("%s:%d: Unknown position %q", path, lineno+i, rule.Position)
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
 func LoadKeysParser(path string, lineno int, lines []string) (interface{}, error) {
 	r := &configKeys{map[string]string{}}
 	lastkey := ""
@@ -246,22 +376,63 @@ func templatesFile() string {
 	return filepath.Join(os.Getenv("HOME"), ".config/yacco/templates")
 }
 
+func languageTemplatesFile(tf util.TemplateFile) string {
+	if filepath.IsAbs(tf.Path) {
+		return tf.Path
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config/yacco", tf.Path)
+}
+
 func IsTemplatesFile(path string) bool {
-	return path == templatesFile()
+	if path == templatesFile() {
+		return true
+	}
+	for _, tf := range TemplateFiles {
+		if path == languageTemplatesFile(tf) {
+			return true
+		}
+	}
+	return false
 }
 
 func LoadTemplates() {
-	Templates = Templates[:0]
+	Templates = readTemplates(templatesFile())
+
+	LanguageTemplates = LanguageTemplates[:0]
+	for _, tf := range TemplateFiles {
+		re, err := regexp.Compile(tf.BufRe)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not compile templates regexp %q: %v\n", tf.BufRe, err)
+			continue
+		}
+		LanguageTemplates = append(LanguageTemplates, LanguageTemplate{re, readTemplates(languageTemplatesFile(tf))})
+	}
+}
+
+// Returns the templates that can be used in the buffer at path, the ones specific to the buffer come first
+func TemplatesFor(path string) []util.Template {
+	r := []util.Template{}
+	for _, lt := range LanguageTemplates {
+		if lt.BufRe.MatchString(path) {
+			r = append(r, lt.Templates...)
+		}
+	}
+	return append(r, Templates...)
+}
 
-	path := templatesFile()
+// Reads a file of templates, templates are separated by lines containing only "---".
+// A template following a "--- snippet" line is a snippet (see util.ExpandSnippet).
+func readTemplates(path string) []util.Template {
+	r := []util.Template{}
 
 	fh, err := os.Open(path)
 	if err != nil {
-		return
+		return r
 	}
 	defer fh.Close()
 
 	cur := []string{}
+	snippet := false
 
 	flush := func() {
 		if len(cur) == 0 {
@@ -272,15 +443,20 @@ func LoadTemplates() {
 		if strings.TrimSpace(txt) == "" {
 			return
 		}
-		Templates = append(Templates, txt)
+		r = append(r, util.Template{Text: txt, Snippet: snippet})
 	}
 
 	scan := bufio.NewScanner(fh)
 	for scan.Scan() {
 		line := scan.Text()
-		if line == "---" {
+		switch line {
+		case "---":
 			flush()
-		} else {
+			snippet = false
+		case "--- snippet":
+			flush()
+			snippet = true
+		default:
 			cur = append(cur, line)
 		}
 	}
@@ -288,4 +464,5 @@ func LoadTemplates() {
 		fmt.Fprintf(os.Stderr, "error reading template file: %v\n", err)
 	}
 	flush()
+	return r
 }
@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/hl"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+A diff view is a pair of editors, placed side by side, whose scrolling is locked so that corresponding lines are aligned.
+Changed lines are colored using a fixed highlighter (the same used by the color file) owned by each editor of the view, other editors of the same buffers keep their colors.
+The differences are recomputed by the main loop once the two buffers stop changing for diffUpdateIdle.
+*/
+
+// color indexes used by diff views, diffEditorColors appends the corresponding colors to the plain editor colors
+const (
+	diffColorRemoved = iota + 5
+	diffColorAdded
+	diffColorChanged
+)
+
+const diffTag = " Diff!Next Diff!Prev Diff!Push Diff!Pull"
+
+const diffUpdateIdle = 300 * time.Millisecond
+
+type diffView struct {
+	a, b         *Editor
+	hunks        []util.DiffHunk
+	revA, revB   int       // revisions of the buffers when the differences were computed
+	seenA, seenB int       // revisions of the buffers last seen by syncDiffViews
+	hlA, hlB     *hl.Fixed // colors of the two editors
+	timer        *time.Timer
+}
+
+var diffViews []*diffView
+
+func DiffCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	args := strings.Fields(arg)
+	if len(args) > 2 {
+		Warn("Diff: too many arguments")
+		return
+	}
+
+	var a, b *Editor
+	var err error
+	if len(args) == 2 {
+		a, err = diffEditor(util.ResolvePath(ec.dir, args[0]))
+		if err == nil {
+			b, err = diffEditor(util.ResolvePath(ec.dir, args[1]))
+			if err != nil {
+				a.Close()
+			}
+		}
+	} else {
+		ed := ec.ed
+		if ed == nil {
+			ed = activeSel.zeroxEd
+		}
+		if ed == nil {
+			Warn("Diff: no buffer to compare")
+			return
+		}
+		switch {
+		case len(args) == 0:
+			var bs []byte
+			bs, err = ioutil.ReadFile(filepath.Join(ed.bodybuf.Dir, ed.bodybuf.Name))
+			if err == nil {
+				a, err = diffScratchEditor(ed.bodybuf, "disk", string(bs))
+			}
+		case args[0] == "HEAD":
+			var text string
+			text, err = gitShowHead(ed.bodybuf)
+			if err == nil {
+				a, err = diffScratchEditor(ed.bodybuf, "HEAD", text)
+			}
+		default:
+			a, err = diffEditor(util.ResolvePath(ed.bodybuf.Dir, args[0]))
+		}
+		if err == nil {
+			b = NewEditor(ed.bodybuf)
+			Log(ed.edid, LOP_ZEROX, ed.bodybuf)
+		}
+	}
+	if err != nil {
+		Warn("Diff: " + err.Error())
+		return
+	}
+
+	placeDiff(a, b)
+
+	dv := &diffView{a: a, b: b, hlA: hl.NewFixed(0), hlB: hl.NewFixed(0)}
+	diffViews = append(diffViews, dv)
+	for _, ed := range []*Editor{a, b} {
+		ed.tagbuf.Replace([]rune(diffTag), &util.Sel{ed.tagbuf.Size(), ed.tagbuf.Size()}, true, nil, 0)
+		ed.TagRefresh()
+	}
+	a.sfr.Fr.Colorfn = func(s, e int) []uint8 { return dv.hlA.Highlight(s, e, a.bodybuf, nil) }
+	b.sfr.Fr.Colorfn = func(s, e int) []uint8 { return dv.hlB.Highlight(s, e, b.bodybuf, nil) }
+	lockScroll(a, b)
+	a.scrollLock.align = func(ln int) int { return diffMapLine(dv.hunks, ln, true) }
+	b.scrollLock.align = func(ln int) int { return diffMapLine(dv.hunks, ln, false) }
+	dv.update()
+	Wnd.FlushImage()
+}
+
+// Returns a new editor for the file at path, sharing the buffer with an existing editor if the file is already open
+func diffEditor(path string) (*Editor, error) {
+	dir, name := filepath.Dir(path), filepath.Base(path)
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			if ed.bodybuf.Dir == dir && ed.bodybuf.Name == name {
+				ned := NewEditor(ed.bodybuf)
+				Log(ed.edid, LOP_ZEROX, ed.bodybuf)
+				return ned, nil
+			}
+		}
+	}
+	ed, err := editOpen(path, false)
+	if err != nil {
+		return nil, err
+	}
+	Log(ed.edid, LOP_NEW, ed.bodybuf)
+	return ed, nil
+}
+
+// Returns an editor for a read only buffer containing text, a version of b
+func diffScratchEditor(b *buf.Buffer, version, text string) (*Editor, error) {
+	sb, err := buf.NewBuffer(b.Dir, fmt.Sprintf("+%s@%s", b.Name, version), true, Wnd.Prop["indentchar"], hl.NilHighlighter)
+	if err != nil {
+		return nil, err
+	}
+	sb.Replace([]rune(text), &util.Sel{0, 0}, true, nil, 0)
+	sb.FlushUndo()
+	sb.Modified = false
+	sb.Editable = false
+	ed := NewEditor(sb)
+	Log(ed.edid, LOP_NEW, ed.bodybuf)
+	return ed, nil
+}
+
+func gitShowHead(b *buf.Buffer) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "show", "HEAD:./"+b.Name)
+	cmd.Dir = b.Dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// Places a in the column of the active editor (or the one before it, if it's the last one) and b beside it
+func placeDiff(a, b *Editor) {
+	if len(Wnd.cols.cols) == 0 {
+		Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), -1, 0.4)
+	}
+	i := 0
+	if activeEditor != nil && activeEditor.Column() != nil {
+		i = Wnd.cols.IndexOf(activeEditor.Column())
+	} else if activeCol != nil {
+		i = Wnd.cols.IndexOf(activeCol)
+	}
+	if i < 0 {
+		i = 0
+	}
+	if i > 0 && i == len(Wnd.cols.cols)-1 {
+		i--
+	}
+	col := Wnd.cols.cols[i]
+	addEditorAt(col, a, col.r.Min.Y+col.r.Dy()/2)
+	placeBeside(a, b)
+}
+
+// Recomputes the differences between the two buffers and their colors
+func (dv *diffView) update() {
+	la := strings.SplitAfter(string(dv.a.bodybuf.SelectionRunes(util.Sel{0, dv.a.bodybuf.Size()})), "\n")
+	lb := strings.SplitAfter(string(dv.b.bodybuf.SelectionRunes(util.Sel{0, dv.b.bodybuf.Size()})), "\n")
+	dv.hunks = util.LineDiff(la, lb)
+	ca, cb := diffColors(la, lb, dv.hunks)
+
+	dv.hlA, dv.hlB = hl.NewFixed(0), hl.NewFixed(0)
+	dv.hlA.Append(ca)
+	dv.hlB.Append(cb)
+	colors := diffEditorColors()
+	dv.a.sfr.Fr.Colors = colors
+	dv.b.sfr.Fr.Colors = colors
+
+	dv.revA, dv.revB = dv.a.bodybuf.RevCount, dv.b.bodybuf.RevCount
+	dv.seenA, dv.seenB = dv.revA, dv.revB
+	dv.a.BufferRefresh()
+	dv.b.BufferRefresh()
+}
+
+// Schedules an update of the differences once the buffers stop changing, called by the main loop when they changed since the last update
+func (dv *diffView) scheduleUpdate() {
+	revA, revB := dv.a.bodybuf.RevCount, dv.b.bodybuf.RevCount
+	if revA != dv.seenA || revB != dv.seenB {
+		dv.seenA, dv.seenB = revA, revB
+		if dv.timer != nil {
+			dv.timer.Stop()
+		}
+		var t *time.Timer
+		t = time.AfterFunc(diffUpdateIdle, func() {
+			sideChan <- func() {
+				if dv.timer == t {
+					dv.timer = nil
+				}
+			}
+		})
+		dv.timer = t
+		return
+	}
+	if dv.timer == nil {
+		dv.update()
+	}
+}
+
+// Restores the colors of the editors of the view
+func (dv *diffView) end() {
+	if dv.timer != nil {
+		dv.timer.Stop()
+		dv.timer = nil
+	}
+	for _, ed := range []*Editor{dv.a, dv.b} {
+		ed.sfr.Fr.Colorfn = nil
+		ed.sfr.Fr.Colors = editorColors
+		if !ed.closed {
+			ed.BufferRefresh()
+		}
+	}
+	if dv.a.scrollLock.ed == dv.b {
+		unlockScroll(dv.a)
+	}
+}
+
+// Returns the colors of each rune of the old text la and the new text lb
+func diffColors(la, lb []string, hunks []util.DiffHunk) (ca, cb []uint8) {
+	sa, ca := diffLineStarts(la)
+	sb, cb := diffLineStarts(lb)
+	paint := func(colors []uint8, s, e int, color uint8) {
+		for i := s; i < e; i++ {
+			colors[i] = color
+		}
+	}
+	for _, h := range hunks {
+		paint(ca, sa[h.A0], sa[h.A1], diffColorRemoved)
+		paint(cb, sb[h.B0], sb[h.B1], diffColorAdded)
+
+		// highlight the changes inside the lines that were modified rather than added or removed
+		for i := 0; h.A0+i < h.A1 && h.B0+i < h.B1; i++ {
+			ra, rb := []rune(la[h.A0+i]), []rune(lb[h.B0+i])
+			for _, rh := range util.LineDiff(runeStrings(ra), runeStrings(rb)) {
+				paint(ca, sa[h.A0+i]+rh.A0, sa[h.A0+i]+rh.A1, diffColorChanged)
+				paint(cb, sb[h.B0+i]+rh.B0, sb[h.B0+i]+rh.B1, diffColorChanged)
+			}
+		}
+	}
+	return ca, cb
+}
+
+// Returns the editor colors with the colors used by diff views appended to the plain colors
+func diffEditorColors() [][]image.Uniform {
+	r := append([][]image.Uniform{}, editorColors...)
+	r[0] = diffThemeColors(editorColors[0])
+	r[5] = highlightColors(r[0], editorColors[3])
+	return r
+}
+
+func diffThemeColors(plain []image.Uniform) []image.Uniform {
+	r := make([]image.Uniform, diffColorRemoved, diffColorChanged+1)
+	for i := range r {
+		if i < len(plain) {
+			r[i] = plain[i]
+		} else {
+			r[i] = plain[1]
+		}
+	}
+	// pick darker or lighter colors depending on the background
+	cr, cg, cb, _ := plain[0].C.RGBA()
+	if cr+cg+cb > 3*0x8000 {
+		return append(r, rgb(0xb0, 0x10, 0x10), rgb(0x10, 0x80, 0x10), rgb(0x10, 0x40, 0xc0))
+	}
+	return append(r, rgb(0xff, 0x70, 0x70), rgb(0x70, 0xe0, 0x70), rgb(0x70, 0xb0, 0xff))
+}
+
+func rgb(r, g, b uint8) image.Uniform {
+	return *image.NewUniform(color.RGBA{r, g, b, 0xff})
+}
+
+// Returns the rune offset of the start of each line (plus the end of the text) and a slice of default colors for the text
+func diffLineStarts(lines []string) ([]int, []uint8) {
+	starts := make([]int, len(lines)+1)
+	for i := range lines {
+		starts[i+1] = starts[i] + len([]rune(lines[i]))
+	}
+	colors := make([]uint8, starts[len(lines)])
+	for i := range colors {
+		colors[i] = 1
+	}
+	return starts, colors
+}
+
+func runeStrings(rs []rune) []string {
+	r := make([]string, len(rs))
+	for i := range rs {
+		r[i] = string(rs[i])
+	}
+	return r
+}
+
+// Maps line ln of the old text (new text if fromA is false) to the corresponding line of the other text
+func diffMapLine(hunks []util.DiffHunk, ln int, fromA bool) int {
+	delta := 0
+	for _, h := range hunks {
+		s0, s1, d0, d1 := h.A0, h.A1, h.B0, h.B1
+		if !fromA {
+			s0, s1, d0, d1 = d0, d1, s0, s1
+		}
+		if ln < s0 {
+			break
+		}
+		if ln < s1 {
+			if off := ln - s0; off < d1-d0 {
+				return d0 + off
+			}
+			return d1
+		}
+		delta = d1 - s1
+	}
+	return ln + delta
+}
+
+// Ends views with a closed editor and updates the ones with a buffer that changed, called by the main loop
+func syncDiffViews() {
+	for i := 0; i < len(diffViews); i++ {
+		dv := diffViews[i]
+		switch {
+		case dv.a.closed || dv.b.closed:
+			dv.end()
+			diffViews = append(diffViews[:i], diffViews[i+1:]...)
+			i--
+		case dv.a.bodybuf.RevCount != dv.revA || dv.b.bodybuf.RevCount != dv.revB:
+			dv.scheduleUpdate()
+		}
+	}
+}
+
+// Returns the diff view containing ed and whether ed is the old side of the view
+func findDiffView(ed *Editor) (*diffView, bool) {
+	for _, dv := range diffViews {
+		switch ed {
+		case dv.a:
+			return dv, true
+		case dv.b:
+			return dv, false
+		}
+	}
+	return nil, false
+}
+
+// Returns the index of the hunk at the cursor of ed, -1 if there isn't one
+func (dv *diffView) hunkAt(ed *Editor, isA bool) int {
+	ln, _ := ed.bodybuf.GetLine(ed.sfr.Fr.Sel.S)
+	ln--
+	for i, h := range dv.hunks {
+		s0, s1 := h.A0, h.A1
+		if !isA {
+			s0, s1 = h.B0, h.B1
+		}
+		if s1 == s0 {
+			// hunk is empty on this side, it sits before line s0
+			s1++
+		}
+		if ln >= s0 && ln < s1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// Moves the cursor of the editor to the next (or previous) hunk
+func DiffNextCmd(ec ExecContext, arg string, dir int) {
+	exitConfirmed = false
+	if ec.ed == nil {
+		return
+	}
+	dv, isA := findDiffView(ec.ed)
+	if dv == nil {
+		Warn("Diff: not a diff view")
+		return
+	}
+	ln, _ := ec.ed.bodybuf.GetLine(ec.ed.sfr.Fr.Sel.S)
+	ln--
+	found := -1
+	for i := range dv.hunks {
+		if dir < 0 {
+			i = len(dv.hunks) - 1 - i
+		}
+		s0 := dv.hunks[i].A0
+		if !isA {
+			s0 = dv.hunks[i].B0
+		}
+		if (dir > 0 && s0 > ln) || (dir < 0 && s0 < ln) {
+			found = s0
+			break
+		}
+	}
+	if found < 0 {
+		return
+	}
+	p := lineOffset(ec.ed.bodybuf, found)
+	ec.ed.sfr.Fr.Sel = util.Sel{p, p}
+	ec.ed.BufferRefresh()
+	ec.ed.Warp()
+}
+
+// Copies the hunk at the cursor of the editor to the other side of the view (or from the other side if pull is set)
+func DiffPushCmd(ec ExecContext, arg string, pull bool) {
+	exitConfirmed = false
+	if ec.ed == nil {
+		return
+	}
+	dv, isA := findDiffView(ec.ed)
+	if dv == nil {
+		Warn("Diff: not a diff view")
+		return
+	}
+	i := dv.hunkAt(ec.ed, isA)
+	if i < 0 {
+		Warn("Diff: no change at cursor")
+		return
+	}
+	h := dv.hunks[i]
+	src, dst := dv.a, dv.b
+	s0, s1, d0, d1 := h.A0, h.A1, h.B0, h.B1
+	if isA == pull {
+		src, dst = dst, src
+		s0, s1, d0, d1 = d0, d1, s0, s1
+	}
+	if !dst.bodybuf.Editable {
+		Warn("Diff: " + dst.bodybuf.ShortName() + " is read only")
+		return
+	}
+	text := src.bodybuf.SelectionRunes(util.Sel{lineOffset(src.bodybuf, s0), lineOffset(src.bodybuf, s1)})
+	sel := util.Sel{lineOffset(dst.bodybuf, d0), lineOffset(dst.bodybuf, d1)}
+	dst.bodybuf.Replace(text, &sel, true, dst.eventChan, util.EO_MOUSE)
+	dst.BufferRefresh()
+}
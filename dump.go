@@ -22,6 +22,7 @@ type DumpColumn struct {
 	Frac    float64
 	Editors []DumpEditor
 	TagText string
+	Stacked bool
 }
 
 type DumpEditor struct {
@@ -30,6 +31,12 @@ type DumpEditor struct {
 	Font    string
 	TagText string
 	SelS    int
+
+	Sel      *util.Sel  // full selection, nil in dumps written by older versions
+	OtherSel []util.Sel // scroll position, addr, mark
+
+	Jumps        []util.Sel // jump ring, see Editor.jumps
+	RestoredJump int
 }
 
 type DumpBuffer struct {
@@ -75,13 +82,23 @@ func LoadFrom(dumpDest string) bool {
 		return false
 	}
 
-	activeEditor = nil
-	activeCol = nil
+	restoreDump(&dw)
+	return true
+}
+
+// Replaces the current layout with the one described by dw
+func restoreDump(dw *DumpWindow) {
+	setActive(nil, nil)
 	activeSel.Reset()
 
 	for i := range Wnd.cols.cols {
-		for j := range Wnd.cols.cols[i].editors {
-			FsRemoveEditor(Wnd.cols.cols[i].editors[j].edid)
+		for _, ed := range Wnd.cols.cols[i].editors {
+			if ed.eventChan != nil {
+				close(ed.eventChan)
+				ed.eventChan = nil
+			}
+			Log(ed.edid, LOP_DEL, ed.bodybuf)
+			ed.Close()
 		}
 	}
 
@@ -120,14 +137,12 @@ func LoadFrom(dumpDest string) bool {
 			col.AddAfter(ed, -1, -1, true)
 
 			ed.tagbuf.Replace([]rune(de.TagText), &util.Sel{ed.tagbuf.EditableStart, ed.tagbuf.Size()}, true, nil, util.EO_MOUSE)
-			if de.SelS != 0 {
-				ed.sfr.Fr.Sel.S = de.SelS
-				ed.sfr.Fr.Sel.E = de.SelS
-			}
+			ed.restoreDumpSels(de)
 		}
 		for i, de := range dc.Editors {
 			col.editors[i].size = int((de.Frac / 10.0) * float64(h))
 		}
+		col.stacked = dc.Stacked
 	}
 
 	for i, dc := range dw.Columns {
@@ -151,8 +166,6 @@ func LoadFrom(dumpDest string) bool {
 			Wnd.cols.cols[i].editors[j].BufferRefreshEx(true, true)
 		}
 	}
-
-	return true
 }
 
 func setDumpTitle() {
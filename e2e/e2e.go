@@ -0,0 +1,356 @@
+// Package e2e drives a running instance of yacco through its 9p interface, it is meant to be used by tests.
+// Every helper fails the test immediately if the 9p server returns an error.
+package e2e
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aarzilli/yacco/util"
+	"github.com/lionkov/go9p/p"
+	"github.com/lionkov/go9p/p/clnt"
+)
+
+// How long WaitEvent and WaitBody wait before failing the test
+var Timeout = 5 * time.Second
+
+type Client struct {
+	t    testing.TB
+	conn *clnt.Clnt
+}
+
+// Connects to the instance of yacco specified by the yp9 environment variable
+func Connect(t testing.TB) *Client {
+	conn, err := util.YaccoConnect()
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	return &Client{t, conn}
+}
+
+func (c *Client) Close() {
+	c.conn.Unmount()
+}
+
+// Reads the file at path
+func (c *Client) Read(path string) string {
+	fh, err := c.conn.FOpen(path, p.OREAD)
+	if err != nil {
+		c.t.Fatalf("opening %s: %v", path, err)
+	}
+	defer fh.Close()
+	bs, err := ioutil.ReadAll(fh)
+	if err != nil && err != io.EOF {
+		c.t.Fatalf("reading %s: %v", path, err)
+	}
+	return string(bs)
+}
+
+// Writes s to the file at path
+func (c *Client) Write(path, s string) {
+	fh, err := c.conn.FOpen(path, p.OWRITE)
+	if err != nil {
+		c.t.Fatalf("opening %s: %v", path, err)
+	}
+	defer fh.Close()
+	if _, err := util.P9Copy(fh, strings.NewReader(s)); err != nil {
+		c.t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// Creates a new buffer called name (an absolute path)
+func (c *Client) New(name string) *Buffer {
+	ctlfd, err := c.conn.FOpen("/new/ctl", p.ORDWR)
+	if err != nil {
+		c.t.Fatalf("creating buffer: %v", err)
+	}
+	bs := make([]byte, 1024)
+	n, err := ctlfd.Read(bs)
+	if err != nil || n < 11 {
+		c.t.Fatalf("reading ctl of new buffer: %v", err)
+	}
+	id := strings.TrimSpace(string(bs[:11]))
+	eventfd, err := c.conn.FOpen("/"+id+"/event", p.ORDWR)
+	if err != nil {
+		c.t.Fatalf("opening event file of %s: %v", id, err)
+	}
+	b := c.makeBuffer(id, ctlfd, eventfd)
+	b.Ctl("name " + name)
+	return b
+}
+
+// Opens the buffer with the specified id
+func (c *Client) Open(id int) *Buffer {
+	sid := strconv.Itoa(id)
+	ctlfd, err := c.conn.FOpen("/"+sid+"/ctl", p.ORDWR)
+	if err != nil {
+		c.t.Fatalf("opening buffer %d: %v", id, err)
+	}
+	eventfd, err := c.conn.FOpen("/"+sid+"/event", p.ORDWR)
+	if err != nil {
+		c.t.Fatalf("opening event file of %d: %v", id, err)
+	}
+	return c.makeBuffer(sid, ctlfd, eventfd)
+}
+
+// Returns the buffer whose path ends with name, nil if it doesn't exist
+func (c *Client) Find(name string) *Buffer {
+	idx, err := util.ReadIndex(c.conn)
+	if err != nil {
+		c.t.Fatalf("reading index: %v", err)
+	}
+	for _, ie := range idx {
+		if strings.HasSuffix(ie.Path, name) {
+			return c.Open(ie.Idx)
+		}
+	}
+	return nil
+}
+
+func (c *Client) makeBuffer(id string, ctlfd, eventfd *clnt.File) *Buffer {
+	bc, err := util.MakeBufferConn(c.conn, id, ctlfd, eventfd)
+	if err != nil {
+		c.t.Fatalf("opening buffer %s: %v", id, err)
+	}
+	b := &Buffer{c: c, conn: bc, Id: id}
+	b.cond = sync.NewCond(&b.mu)
+	go b.readEvents()
+	return b
+}
+
+// A buffer opened through 9p.
+// Events sent by yacco on the event file of the buffer are collected as soon as the buffer is opened and can be retrieved with WaitEvent.
+type Buffer struct {
+	c    *Client
+	conn *util.BufferConn
+	Id   string
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []Event
+	closed bool
+}
+
+// An event read from the event file of a buffer
+type Event struct {
+	Origin util.EventOrigin
+	Type   util.EventType
+	S, E   int
+	Text   string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%c%c %d %d %q", e.Origin, e.Type, e.S, e.E, e.Text)
+}
+
+func (b *Buffer) readEvents() {
+	var er util.EventReader
+	for {
+		err := er.ReadFrom(b.conn.EventFd)
+		if err != nil {
+			break
+		}
+		if ok, _ := er.Valid(); !ok {
+			continue
+		}
+		_, s, e := er.Points()
+		txt, _ := er.Text(nil, nil, nil)
+		b.mu.Lock()
+		b.events = append(b.events, Event{er.Origin(), er.Type(), s, e, txt})
+		b.mu.Unlock()
+		b.cond.Broadcast()
+	}
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+func (b *Buffer) Close() {
+	b.conn.Close()
+}
+
+// Writes commands to the ctl file
+func (b *Buffer) Ctl(cmds ...string) {
+	for _, cmd := range cmds {
+		if _, err := b.conn.CtlFd.Write([]byte(cmd)); err != nil {
+			b.c.t.Fatalf("writing %q to ctl of %s: %v", cmd, b.Id, err)
+		}
+	}
+}
+
+// Executes cmd as if it was clicked in the body of the buffer
+func (b *Buffer) Exec(cmd string) {
+	msg := fmt.Sprintf("%c%c0 0 0 %d %s\n", util.EO_BODYTAG, util.ET_BODYEXEC, len([]rune(cmd)), cmd)
+	// the event file is being read by readEvents, use WriteAt so that the offset of the file isn't touched
+	if _, err := b.conn.EventFd.WriteAt([]byte(msg), 0); err != nil {
+		b.c.t.Fatalf("executing %q in %s: %v", cmd, b.Id, err)
+	}
+}
+
+// Replaces the contents of the body
+func (b *Buffer) SetBody(s string) {
+	b.SetAddr(",")
+	b.WriteData(s)
+}
+
+func (b *Buffer) Body() string {
+	return b.c.Read("/" + b.Id + "/body")
+}
+
+func (b *Buffer) Tag() string {
+	tag, err := b.conn.GetTag()
+	if err != nil {
+		b.c.t.Fatalf("reading tag of %s: %v", b.Id, err)
+	}
+	return tag
+}
+
+// Sets the addr file to addr, an address in Edit syntax
+func (b *Buffer) SetAddr(addr string) {
+	if _, err := b.conn.AddrFd.Write([]byte(addr)); err != nil {
+		b.c.t.Fatalf("writing %q to addr of %s: %v", addr, b.Id, err)
+	}
+}
+
+// Returns the current value of the addr file
+func (b *Buffer) Addr() (s, e int) {
+	v, err := b.conn.ReadAddr()
+	if err != nil {
+		b.c.t.Fatalf("reading addr of %s: %v", b.Id, err)
+	}
+	return v[0], v[1]
+}
+
+// Returns the text of the selection of the body
+func (b *Buffer) Dot() string {
+	b.Ctl("addr=dot")
+	return b.c.Read("/" + b.Id + "/xdata")
+}
+
+// Selects the text at addr
+func (b *Buffer) SetDot(addr string) {
+	b.SetAddr(addr)
+	b.Ctl("dot=addr")
+}
+
+// Replaces the text at addr with s
+func (b *Buffer) WriteData(s string) {
+	if s == "" {
+		s = "\x00"
+	}
+	b.c.Write("/"+b.Id+"/data", s)
+}
+
+// Waits until the body of the buffer is equal to expected, fails the test after Timeout
+func (b *Buffer) WaitBody(expected string) {
+	deadline := time.Now().Add(Timeout)
+	for {
+		body := b.Body()
+		if body == expected {
+			return
+		}
+		if time.Now().After(deadline) {
+			b.c.t.Fatalf("body of %s mismatch:\nexpected:\n%q\ngot:\n%q", b.Id, expected, body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Waits for an event that satisfies match, events that precede it are discarded. Fails the test after Timeout.
+func (b *Buffer) WaitEvent(match func(Event) bool) Event {
+	expired := false
+	timer := time.AfterFunc(Timeout, func() {
+		b.mu.Lock()
+		expired = true
+		b.mu.Unlock()
+		b.cond.Broadcast()
+	})
+	defer timer.Stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for i, e := range b.events {
+			if match(e) {
+				b.events = b.events[i+1:]
+				return e
+			}
+		}
+		b.events = b.events[:0]
+		if b.closed || expired {
+			b.c.t.Fatalf("event not received on %s", b.Id)
+		}
+		b.cond.Wait()
+	}
+}
+
+// A reader of a watch file
+type Watcher struct {
+	t    testing.TB
+	conn *clnt.Clnt
+	msgs chan string
+}
+
+// Opens the watch file at path. Every watcher uses its own connection, closing it is the only way to interrupt a pending read.
+func (c *Client) Watch(path string) *Watcher {
+	return c.WatchN(path, 1)[0]
+}
+
+// Opens the watch file at path n times over a single connection, closing any of the returned watchers closes all of them.
+func (c *Client) WatchN(path string, n int) []*Watcher {
+	conn, err := util.YaccoConnect()
+	if err != nil {
+		c.t.Fatalf("connecting: %v", err)
+	}
+	ws := make([]*Watcher, n)
+	for i := range ws {
+		fh, err := conn.FOpen(path, p.OREAD)
+		if err != nil {
+			c.t.Fatalf("opening %s: %v", path, err)
+		}
+		w := &Watcher{c.t, conn, make(chan string, 100)}
+		go func() {
+			defer close(w.msgs)
+			bs := make([]byte, 2*util.MAX_EVENT_TEXT_LENGTH)
+			for {
+				n, err := fh.Read(bs)
+				if err != nil || n == 0 {
+					return
+				}
+				w.msgs <- string(bs[:n])
+			}
+		}()
+		ws[i] = w
+	}
+	return ws
+}
+
+// Waits for a message that satisfies match, messages that precede it are discarded. Fails the test after Timeout.
+func (w *Watcher) Wait(match func(msg string) bool) string {
+	timer := time.NewTimer(Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case msg, ok := <-w.msgs:
+			if !ok {
+				w.t.Fatalf("watch file closed")
+			}
+			if match(msg) {
+				return msg
+			}
+		case <-timer.C:
+			w.t.Fatalf("message not received from watch file")
+		}
+	}
+}
+
+func (w *Watcher) Close() {
+	w.conn.Unmount()
+}
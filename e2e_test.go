@@ -0,0 +1,1511 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarzilli/yacco/clipboard"
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/e2e"
+	"github.com/aarzilli/yacco/edit"
+	"github.com/aarzilli/yacco/headless"
+	"github.com/aarzilli/yacco/util"
+)
+
+var testDir string
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	var err error
+	testDir, err = ioutil.TempDir("", "yacco-e2e")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not create temporary directory: %v\n", err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", testDir)
+
+	config.SaveHooks = []util.SaveHook{
+		{BufRe: `\.fmttest$`, Kind: "fmt", Cmd: "sed s/fix/fixed/"},
+		{BufRe: `\.fmttest$`, Kind: "lint", Cmd: "echo linted $p"},
+		{BufRe: `\.slowfmt$`, Kind: "fmt", Cmd: "sleep 0.5; cat"},
+		{BufRe: `\.slowfix$`, Kind: "fmt", Cmd: "sleep 0.2; sed s/fix/fixed/"},
+	}
+
+	*headlessFlag = true
+	setup()
+	go realmain(headless.NewScreen())
+
+	// wait for the main loop to start
+	onMainLoop(func() {})
+
+	r := m.Run()
+	if v := strings.SplitN(os.Getenv("yp9"), "!", 2); len(v) == 2 && v[0] == "unix" {
+		os.Remove(v[1])
+	}
+	os.RemoveAll(testDir)
+	os.Exit(r)
+}
+
+// Runs f on the main loop and waits for it to return
+func onMainLoop(f func()) {
+	done := make(chan struct{})
+	sideChan <- func() {
+		f()
+		close(done)
+	}
+	<-done
+}
+
+// Removes ed from the window, must be called on the main loop
+func closeEditor(ed *Editor) {
+	col := ed.Column()
+	col.Remove(col.IndexOf(ed))
+	ed.Close()
+}
+
+// Waits until cond, evaluated on the main loop, returns true
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	ok := false
+	for i := 0; i < 100 && !ok; i++ {
+		onMainLoop(func() { ok = cond() })
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if !ok {
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+func newTestBuffer(t *testing.T, c *e2e.Client, body string) *e2e.Buffer {
+	path := filepath.Join(testDir, t.Name())
+	os.Remove(path)
+	b := c.New(path)
+	b.SetBody(body)
+	b.WaitBody(body)
+	return b
+}
+
+func TestData(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "hello world\n")
+	defer b.Close()
+
+	b.SetAddr("#0/world/")
+	if s, e := b.Addr(); s != 6 || e != 11 {
+		t.Fatalf("wrong addr %d,%d", s, e)
+	}
+	b.WriteData("there")
+	b.WaitBody("hello there\n")
+}
+
+func TestPut(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "some content\n")
+	defer b.Close()
+
+	b.Exec("Put")
+
+	path := filepath.Join(testDir, t.Name())
+	deadline := time.Now().Add(e2e.Timeout)
+	for {
+		bs, _ := ioutil.ReadFile(path)
+		if string(bs) == "some content\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wrong file contents %q", string(bs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if strings.Contains(strings.Split(b.Tag(), " ")[0], "*") {
+		t.Fatalf("buffer still modified after Put: %q", b.Tag())
+	}
+}
+
+func TestPasteIndent(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	body := "foo()\nbar()\n\nif x {\n\t\n}\n"
+	b := newTestBuffer(t, c, body)
+	defer b.Close()
+
+	b.SetDot("1,2")
+	b.Exec("Copy")
+	b.SetDot(fmt.Sprintf("#%d", strings.Index(body, "\t\n")+1))
+	b.Exec("Paste Indent")
+	b.WaitBody("foo()\nbar()\n\nif x {\n\tfoo()\n\tbar()\n\t\n}\n")
+}
+
+func TestClipboardHistory(t *testing.T) {
+	_, eds, cleanup := newTestColumn(t, "cliphist.txt")
+	defer cleanup()
+	ed := eds[0]
+	wd, _ := os.Getwd()
+	defer onMainLoop(func() {
+		if cbed := openEditorFor(filepath.Join(wd, "+Clipboard")); cbed != nil {
+			closeEditor(cbed)
+		}
+	})
+
+	onMainLoop(func() {
+		ec := ExecContext{ed: ed, fr: &ed.sfr.Fr, buf: ed.bodybuf, br: ed.BufferRefresh, norefresh: true}
+		body := func() string { return string(ed.bodybuf.SelectionRunes(util.Sel{0, ed.bodybuf.Size()})) }
+		emptyBody := func() {
+			ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+			ed.bodybuf.Replace([]rune{}, &ed.sfr.Fr.Sel, true, nil, 0)
+		}
+
+		// the oldest entries are dropped once the history is full
+		for i := 0; i < clipboard.HistorySize+8; i++ {
+			clipboardSet(fmt.Sprintf("clip%d", i))
+		}
+		h := clipboard.History()
+		if len(h) != clipboard.HistorySize || h[0] != fmt.Sprintf("clip%d", clipboard.HistorySize+7) || h[len(h)-1] != "clip8" {
+			t.Errorf("wrong clipboard history %q", h)
+		}
+
+		// copying an entry again moves it to the front
+		clipboardSet("clip20")
+		h = clipboard.History()
+		if len(h) != clipboard.HistorySize || h[0] != "clip20" || h[1] != fmt.Sprintf("clip%d", clipboard.HistorySize+7) {
+			t.Errorf("wrong clipboard history after copying an entry again %q", h)
+		}
+
+		emptyBody()
+		PasteCmd(ec, "2")
+		if body() != h[1] {
+			t.Errorf("Paste 2 inserted %q", body())
+		}
+
+		// Paste Cycle goes through the whole history and starts again from the most recent entry
+		emptyBody()
+		for i := 0; i <= len(h); i++ {
+			PasteCmd(ec, "Cycle")
+			if exp := h[i%len(h)]; body() != exp {
+				t.Errorf("Paste Cycle %d inserted %q, expected %q", i, body(), exp)
+				break
+			}
+		}
+
+		ClipboardCmd(ec, "")
+		cbed := openEditorFor(filepath.Join(wd, "+Clipboard"))
+		if cbed == nil {
+			t.Errorf("+Clipboard not opened")
+			return
+		}
+		cb := string(cbed.bodybuf.SelectionRunes(util.Sel{0, cbed.bodybuf.Size()}))
+		if lines := strings.Split(cb, "\n"); len(lines) != len(h)+1 || lines[0] != "Paste 1\tclip20" || lines[1] != "Paste 2\t"+h[1] {
+			t.Errorf("wrong +Clipboard %q", cb)
+		}
+	})
+}
+
+func TestLook(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "alpha beta alpha gamma\n")
+	defer b.Close()
+
+	b.SetDot("#0")
+	b.Exec("Look alpha")
+	b.Exec("Look alpha")
+	if dot := b.Dot(); dot != "alpha" {
+		t.Fatalf("wrong selection %q", dot)
+	}
+	if s, e := b.Addr(); s != 11 || e != 16 {
+		t.Fatalf("wrong selection %d,%d", s, e)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "")
+	defer b.Close()
+
+	b.SetAddr("$")
+	b.WriteData("inserted")
+	e := b.WaitEvent(func(e e2e.Event) bool { return e.Type == util.ET_BODYINS && e.Text != "" })
+	if e.Origin != util.EO_FILES || e.S != 0 || e.Text != "inserted" {
+		t.Fatalf("wrong event %v", e)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "")
+	defer b.Close()
+
+	w1 := c.Watch("/" + b.Id + "/watch")
+	defer w1.Close()
+	w2 := c.Watch("/" + b.Id + "/watch")
+	defer w2.Close()
+	wg := c.Watch("/watch")
+	defer wg.Close()
+
+	b.SetAddr("$")
+	b.WriteData("watched")
+	b.Exec("Look watched")
+
+	for _, w := range []*e2e.Watcher{w1, w2} {
+		w.Wait(func(msg string) bool { return msg == "FI0 0 0 7 watched\n" })
+		w.Wait(func(msg string) bool {
+			return strings.HasPrefix(msg, "MX") && strings.HasSuffix(msg, " Look watched\n")
+		})
+	}
+	wg.Wait(func(msg string) bool { return msg == b.Id+" FI0 0 0 7 watched\n" })
+
+	// the event file is still owned by b
+	e := b.WaitEvent(func(e e2e.Event) bool { return e.Type == util.ET_BODYINS && e.Text != "" })
+	if e.Text != "watched" {
+		t.Fatalf("wrong event %v", e)
+	}
+
+	// undo and redo are reported too
+	b.Exec("Undo")
+	w1.Wait(func(msg string) bool { return msg == "MD0 7 0 0 \n" })
+	b.Exec("Redo")
+	w1.Wait(func(msg string) bool { return msg == "MI0 0 0 7 watched\n" })
+}
+
+func TestJsonLog(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	w := c.Watch("/jsonlog")
+	defer w.Close()
+	// every open of the file is a separate reader, also on the same connection
+	same := c.WatchN("/jsonlog", 2)
+	defer same[0].Close()
+	b := newTestBuffer(t, c, "logged\n")
+	defer b.Close()
+
+	b.Exec("Put")
+	b.Exec("true")
+
+	var e jsonLogEntry
+	wait := func(event string) {
+		w.Wait(func(msg string) bool {
+			e = jsonLogEntry{}
+			if err := json.Unmarshal([]byte(msg), &e); err != nil {
+				t.Fatalf("could not parse %q: %v", msg, err)
+			}
+			return e.Event == event
+		})
+	}
+
+	wait("exec")
+	if e.Cmd != "Put" || e.Buffer == nil || e.Buffer.Path != filepath.Join(testDir, t.Name()) {
+		t.Fatalf("wrong exec entry %#v", e)
+	}
+	wait("put")
+	if e.Buffer.Checksum != fmt.Sprintf("%x", sha1.Sum([]byte("logged\n"))) || e.Buffer.Modified {
+		t.Fatalf("wrong put entry %#v", e.Buffer)
+	}
+	wait("job-start")
+	if e.Cmd != "true" || e.Job == nil || e.Job.Pid == 0 {
+		t.Fatalf("wrong job-start entry %#v", e)
+	}
+	wait("job-end")
+	if e.Cmd != "true" || e.Job.Error != "" {
+		t.Fatalf("wrong job-end entry %#v", e)
+	}
+
+	for _, w := range same {
+		w.Wait(func(msg string) bool {
+			e = jsonLogEntry{}
+			json.Unmarshal([]byte(msg), &e)
+			return e.Event == "job-end" && e.Cmd == "true"
+		})
+	}
+}
+
+func TestSaveHooks(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	path := filepath.Join(testDir, "hooks.fmttest")
+	os.Remove(path)
+	b := c.New(path)
+	defer b.Close()
+	b.SetBody("fix\nkeep\n")
+	b.WaitBody("fix\nkeep\n")
+
+	b.SetDot("#0/keep/")
+	b.Exec("Put")
+	b.WaitBody("fixed\nkeep\n")
+	if bs, _ := ioutil.ReadFile(path); string(bs) != "fixed\nkeep\n" {
+		t.Fatalf("wrong file contents %q", string(bs))
+	}
+	if dot := b.Dot(); dot != "keep" {
+		t.Fatalf("selection not preserved %q", dot)
+	}
+
+	deadline := time.Now().Add(e2e.Timeout)
+	for {
+		if errb := c.Find(filepath.Join(testDir, "+Error")); errb != nil {
+			body := errb.Body()
+			errb.Close()
+			if strings.Contains(body, "linted "+path) {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("linter output not found")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	b.Exec("Undo")
+	b.WaitBody("fix\nkeep\n")
+}
+
+func TestSaveHooksEditWhileFormatting(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	name := fmt.Sprintf("hooks%d.slowfmt", time.Now().UnixNano())
+	path := filepath.Join(testDir, name)
+	b := c.New(path)
+	defer b.Close()
+	b.SetBody("before\n")
+	b.WaitBody("before\n")
+
+	// the editor keeps running while the formatter does
+	b.Exec("Put")
+	b.SetBody("after\n")
+	b.WaitBody("after\n")
+
+	deadline := time.Now().Add(e2e.Timeout)
+	for {
+		if errb := c.Find(filepath.Join(testDir, "+Error")); errb != nil {
+			body := errb.Body()
+			errb.Close()
+			if strings.Contains(body, name+" was modified while it was being formatted") {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("warning not found")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatalf("file saved")
+	}
+}
+
+func TestSaveHooksPutallZerox(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	name := fmt.Sprintf("putall%d.slowfix", time.Now().UnixNano())
+	path := filepath.Join(testDir, name)
+	b := c.New(path)
+	defer b.Close()
+	defer onMainLoop(func() {
+		for ed := openEditorFor(path); ed != nil; ed = openEditorFor(path) {
+			closeEditor(ed)
+		}
+	})
+	b.SetBody("fix\n")
+	b.WaitBody("fix\n")
+
+	// the buffer is formatted and saved once, not once per editor
+	b.Exec("Zerox")
+	b.Exec("Putall")
+	waitFor(t, "Putall", func() bool {
+		bs, _ := ioutil.ReadFile(path)
+		return string(bs) == "fixed\n"
+	})
+	time.Sleep(200 * time.Millisecond)
+	if errb := c.Find(filepath.Join(testDir, "+Error")); errb != nil {
+		body := errb.Body()
+		errb.Close()
+		if strings.Contains(body, name) {
+			t.Fatalf("unexpected warning %q", body)
+		}
+	}
+}
+
+func TestPipeMinimal(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "a\nb\nc\n")
+	defer b.Close()
+
+	b.Exec("Edit ,| sed s/[ac]/X/")
+	b.WaitBody("X\nb\nX\n")
+	b.Exec("Undo")
+	b.WaitBody("a\nb\nc\n")
+
+	// nothing changes, the selection stays where it was
+	b.SetDot("#2,#3")
+	b.Exec("Edit | cat")
+	b.WaitBody("a\nb\nc\n")
+	if dot := b.Dot(); dot != "b" {
+		t.Fatalf("selection moved %q", dot)
+	}
+}
+
+func TestGetMinimal(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "one\nkeep\nthree\n")
+	defer b.Close()
+	b.Exec("Put")
+	path := filepath.Join(testDir, t.Name())
+	if bs, _ := ioutil.ReadFile(path); string(bs) != "one\nkeep\nthree\n" {
+		t.Fatalf("wrong file contents %q", string(bs))
+	}
+
+	b.SetDot("#0/keep/")
+	if err := ioutil.WriteFile(path, []byte("zero\none\nkeep\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	b.Exec("Get")
+	b.WaitBody("zero\none\nkeep\n")
+	if dot := b.Dot(); dot != "keep" {
+		t.Fatalf("selection not preserved %q", dot)
+	}
+}
+
+func TestSplitLock(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	lines := make([]string, 500)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i)
+	}
+	b := newTestBuffer(t, c, strings.Join(lines, "\n")+"\n")
+	defer b.Close()
+
+	b.Exec("Split lock")
+
+	var ed, other *Editor
+	samecol := false
+	onMainLoop(func() {
+		for _, col := range Wnd.cols.cols {
+			for _, ced := range col.editors {
+				if strconv.Itoa(ced.edid) == b.Id {
+					ed = ced
+				}
+			}
+		}
+		if ed != nil {
+			other = ed.scrollLock.ed
+		}
+		if other != nil {
+			samecol = other.Column() == ed.Column()
+		}
+	})
+	if ed == nil || other == nil {
+		t.Fatalf("split editor not locked")
+	}
+	if other.bodybuf != ed.bodybuf || samecol {
+		t.Fatalf("split editor not a zerox in another column")
+	}
+	defer onMainLoop(func() { closeEditor(other) })
+
+	// scroll like clicking on the scrollbar does, the lock is checked at the end of the main loop iteration
+	onMainLoop(func() { ed.sfr.Fr.Scroll(0, len(strings.Join(lines[:300], "\n"))+1) })
+
+	var edTop, otherTop int
+	onMainLoop(func() {
+		edTop, _ = ed.bodybuf.GetLine(ed.otherSel[OS_TOP].E)
+		otherTop, _ = other.bodybuf.GetLine(other.otherSel[OS_TOP].E)
+	})
+	if edTop != 301 || edTop != otherTop {
+		t.Fatalf("scroll not propagated: %d %d", edTop, otherTop)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "")
+	defer b.Close()
+	pa, pb := filepath.Join(testDir, "diff-a"), filepath.Join(testDir, "diff-b")
+	ioutil.WriteFile(pa, []byte("one\ntwo\nthree\n"), 0666)
+	ioutil.WriteFile(pb, []byte("one\nTWO\nthree\nfour\n"), 0666)
+
+	b.Exec("Diff diff-a diff-b")
+
+	var dv *diffView
+	var hunks []util.DiffHunk
+	var colors, bufColors []uint8
+	var ncolors int
+	onMainLoop(func() {
+		if len(diffViews) > 0 {
+			dv = diffViews[len(diffViews)-1]
+			hunks = dv.hunks
+			colors = dv.a.sfr.Fr.Colorfn(0, dv.a.bodybuf.Size())
+			bufColors = append([]uint8{}, dv.a.bodybuf.Highlight(0, dv.a.bodybuf.Size())...)
+			ncolors = len(dv.a.sfr.Fr.Colors[0])
+		}
+	})
+	if dv == nil {
+		t.Fatalf("diff view not created")
+	}
+	if fmt.Sprint(hunks) != "[{1 2 1 2} {3 3 3 4}]" {
+		t.Fatalf("wrong hunks %v", hunks)
+	}
+	if fmt.Sprint(colors[4:8]) != fmt.Sprint([]uint8{diffColorChanged, diffColorChanged, diffColorChanged, diffColorRemoved}) {
+		t.Fatalf("wrong colors %v", colors)
+	}
+	// the buffer and the other editors keep their colors
+	for _, c := range bufColors {
+		if c >= diffColorRemoved {
+			t.Fatalf("diff colors in the buffer highlighter %v", bufColors)
+		}
+	}
+	if ncolors <= diffColorChanged || len(editorColors[0]) >= ncolors {
+		t.Fatalf("wrong editor colors %d %d", ncolors, len(editorColors[0]))
+	}
+
+	var body string
+	onMainLoop(func() {
+		dv.a.sfr.Fr.Sel = util.Sel{5, 5}
+		DiffPushCmd(ExecContext{ed: dv.a}, "", true)
+		body = string(dv.a.bodybuf.SelectionRunes(util.Sel{0, dv.a.bodybuf.Size()}))
+	})
+	if body != "one\nTWO\nthree\n" {
+		t.Fatalf("wrong body after Diff!Pull %q", body)
+	}
+	waitFor(t, "diff update", func() bool { return fmt.Sprint(dv.hunks) == "[{3 3 3 4}]" })
+
+	onMainLoop(func() {
+		closeEditor(dv.a)
+		closeEditor(dv.b)
+	})
+	found := true
+	onMainLoop(func() {
+		found = false
+		for _, x := range diffViews {
+			if x == dv {
+				found = true
+			}
+		}
+	})
+	if found {
+		t.Fatalf("diff view not removed")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "x\n")
+	defer b.Close()
+
+	var ed *Editor
+	onMainLoop(func() {
+		config.Templates = []util.Template{{Text: "for ${1:i} := 0; $1 < ${2:n}; $1++ {\n\t$0\n}", Snippet: true}}
+		for _, col := range Wnd.cols.cols {
+			for _, ced := range col.editors {
+				if strconv.Itoa(ced.edid) == b.Id {
+					ed = ced
+				}
+			}
+		}
+	})
+	defer onMainLoop(func() { config.Templates = nil })
+	if ed == nil {
+		t.Fatalf("editor not found")
+	}
+
+	var body string
+	var sel util.Sel
+	state := func() {
+		body = string(ed.bodybuf.SelectionRunes(util.Sel{0, ed.bodybuf.Size()}))
+		sel = ed.sfr.Fr.Sel
+	}
+	typ := func(s string) {
+		onMainLoop(func() { ed.bodybuf.Replace([]rune(s), &ed.sfr.Fr.Sel, true, nil, util.EO_KBD) })
+	}
+
+	b.SetDot("#2")
+	b.Exec("Template for")
+	onMainLoop(state)
+	if body != "x\nfor i := 0; i < n; i++ {\n\t\n}" || sel != (util.Sel{6, 7}) {
+		t.Fatalf("wrong expansion %q %v", body, sel)
+	}
+
+	typ("j")
+	typ("k")
+	onMainLoop(state)
+	if body != "x\nfor jk := 0; jk < n; jk++ {\n\t\n}" || sel != (util.Sel{8, 8}) {
+		t.Fatalf("mirrors not updated %q %v", body, sel)
+	}
+
+	onMainLoop(func() {
+		snippetNext()
+		state()
+	})
+	if sel != (util.Sel{20, 21}) {
+		t.Fatalf("wrong second stop %v", sel)
+	}
+	typ("len(v)")
+	onMainLoop(func() {
+		snippetNext()
+		state()
+	})
+	if body != "x\nfor jk := 0; jk < len(v); jk++ {\n\t\n}" || sel != (util.Sel{36, 36}) {
+		t.Fatalf("wrong final position %q %v", body, sel)
+	}
+	active := true
+	onMainLoop(func() { active = snippetActive(ed) })
+	if active {
+		t.Fatalf("snippet still active after the last stop")
+	}
+
+	// templates that aren't snippets are inserted as they are
+	onMainLoop(func() {
+		config.Templates = []util.Template{{Text: "price: $1 ${2:x}\n"}}
+		ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	})
+	b.Exec("Template price")
+	onMainLoop(func() {
+		state()
+		active = snippetActive(ed)
+	})
+	if body != "price: $1 ${2:x}\n" || active {
+		t.Fatalf("template expanded %q %v", body, active)
+	}
+}
+
+func TestLookReplace(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "alpha beta Alpha gamma alpha\n")
+	defer b.Close()
+
+	var ed *Editor
+	onMainLoop(func() {
+		for _, col := range Wnd.cols.cols {
+			for _, ced := range col.editors {
+				if strconv.Itoa(ced.edid) == b.Id {
+					ed = ced
+				}
+			}
+		}
+	})
+	if ed == nil {
+		t.Fatalf("editor not found")
+	}
+
+	waitSpecial := func(want bool) {
+		waitFor(t, "interactive Look", func() bool { return (ed.eventChanSpecial && ed.specialTag != "") == want })
+	}
+	look := func(tag string) {
+		b.SetDot("#0")
+		b.Exec("Look")
+		waitSpecial(true)
+		onMainLoop(func() {
+			ed.tagbuf.Replace([]rune(tag), &util.Sel{ed.tagbuf.EditableStart, ed.tagbuf.Size()}, true, ed.eventChan, util.EO_KBD)
+		})
+	}
+	send := func(cmd string) {
+		onMainLoop(func() { SpecialSendCmd(ExecContext{ed: ed}, cmd) })
+	}
+	sel := func() (s util.Sel) {
+		onMainLoop(func() { s = ed.sfr.Fr.Sel })
+		return s
+	}
+
+	look("alpha\tomega")
+	send("Look!Replace")
+	b.WaitBody("omega beta Alpha gamma alpha\n")
+	if s := sel(); s != (util.Sel{11, 16}) {
+		t.Fatalf("wrong selection after Look!Replace %v", s)
+	}
+	send("Look!Skip")
+	send("Look!Case")
+	send("Look!ReplaceAll")
+	b.WaitBody("omega beta Alpha gamma omega\n")
+	send("Escape")
+	waitSpecial(false)
+
+	onMainLoop(func() { ed.bodybuf.Undo(&ed.sfr.Fr.Sel, false) })
+	b.WaitBody("alpha beta Alpha gamma alpha\n")
+
+	look(`a(l+)pha` + "\t<\\1>")
+	send("Look!Regexp")
+	send("Look!ReplaceAll")
+	b.WaitBody("<l> beta <l> gamma <l>\n")
+	send("Escape")
+	waitSpecial(false)
+}
+
+func TestLookHighlight(t *testing.T) {
+	c := e2e.Connect(t)
+	defer c.Close()
+	b := newTestBuffer(t, c, "foo bar Foo baz foo\n")
+	defer b.Close()
+
+	var ed *Editor
+	onMainLoop(func() {
+		for _, col := range Wnd.cols.cols {
+			for _, ced := range col.editors {
+				if strconv.Itoa(ced.edid) == b.Id {
+					ed = ced
+				}
+			}
+		}
+	})
+	if ed == nil {
+		t.Fatalf("editor not found")
+	}
+
+	// only visible matches are highlighted, the editor is moved to its own column so that it is large enough to show the whole buffer
+	visible, size := 0, 0
+	var col *Col
+	onMainLoop(func() {
+		oldcol := ed.Column()
+		oldcol.Remove(oldcol.IndexOf(ed))
+		col = Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), -1, 0.4)
+		col.AddAfter(ed, -1, 0, false)
+		visible, size = ed.sfr.Fr.Size(), ed.bodybuf.Size()
+	})
+	defer onMainLoop(func() {
+		closeEditor(ed)
+		Wnd.cols.Remove(Wnd.cols.IndexOf(col))
+	})
+	if visible < size {
+		t.Fatalf("editor too small (%d)", visible)
+	}
+
+	highlights := func() string { return fmt.Sprint(ed.sfr.Fr.Highlights) }
+
+	b.SetDot("#0")
+	b.Exec("Look")
+	waitFor(t, "interactive Look", func() bool { return ed.eventChanSpecial && ed.specialTag != "" })
+	onMainLoop(func() {
+		ed.tagbuf.Replace([]rune("foo"), &util.Sel{ed.tagbuf.EditableStart, ed.tagbuf.Size()}, true, ed.eventChan, util.EO_KBD)
+	})
+	waitFor(t, "match count", func() bool { return strings.HasSuffix(ed.specialTag, " 1/3") })
+	if h := highlights(); h != "[{0 3} {8 11} {16 19}]" {
+		t.Fatalf("wrong highlights %s", h)
+	}
+
+	onMainLoop(func() { SpecialSendCmd(ExecContext{ed: ed}, "Look!Case") })
+	waitFor(t, "exact match count", func() bool { return strings.HasSuffix(ed.specialTag, " 1/2") })
+	if h := highlights(); h != "[{0 3} {16 19}]" {
+		t.Fatalf("wrong highlights %s", h)
+	}
+	onMainLoop(func() { SpecialSendCmd(ExecContext{ed: ed}, "Look!Again") })
+	waitFor(t, "second match", func() bool { return strings.HasSuffix(ed.specialTag, " 2/2") })
+
+	onMainLoop(func() { SpecialSendCmd(ExecContext{ed: ed}, "Escape") })
+	waitFor(t, "end of interactive Look", func() bool { return !ed.eventChanSpecial })
+	if h := highlights(); h != "[]" {
+		t.Fatalf("highlights not removed %s", h)
+	}
+
+	onMainLoop(func() {
+		Wnd.Prop["hlword"] = "yes"
+		LastTypeTime = time.Time{}
+		ed.sfr.Fr.VisibleTick = true
+		ed.sfr.Fr.Sel = util.Sel{17, 17}
+	})
+	defer onMainLoop(func() { Wnd.Prop["hlword"] = "no" })
+	waitFor(t, "word highlight", func() bool { return highlights() == "[{0 3} {16 19}]" })
+}
+
+func TestPlacementAndLayout(t *testing.T) {
+	src := filepath.Join(testDir, "placement.txt")
+	for _, p := range []string{src, filepath.Join(testDir, "placement_test.txt")} {
+		if err := ioutil.WriteFile(p, []byte("x\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config.PlacementRules = []util.PlacementRule{
+		{BufRe: `^(.*)_test\.txt$`, Column: "beside $1.txt"},
+		{BufRe: `/\+Placement$`, Column: "last", Position: "bottom"},
+		{BufRe: `/\+PlacementTop$`, Column: "last", Position: "top"},
+	}
+	PlacementInit()
+	defer func() {
+		config.PlacementRules = nil
+		PlacementInit()
+	}()
+
+	var eds []*Editor
+	onMainLoop(func() {
+		Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), 0, 0.5)
+		for _, name := range []string{"placement.txt", "placement_test.txt", "+Placement"} {
+			ed, err := EditFind(testDir, name, false, true)
+			if err != nil {
+				t.Errorf("opening %s: %v", name, err)
+				return
+			}
+			eds = append(eds, ed)
+		}
+	})
+	if len(eds) != 3 {
+		t.FailNow()
+	}
+	defer onMainLoop(func() {
+		for _, ed := range eds {
+			closeEditor(ed)
+		}
+	})
+
+	onMainLoop(func() {
+		col := eds[0].Column()
+		if eds[1].Column() != col || col.IndexOf(eds[1]) != col.IndexOf(eds[0])+1 {
+			t.Errorf("test file not placed below its source")
+		}
+		last := Wnd.cols.cols[len(Wnd.cols.cols)-1]
+		if eds[2].Column() != last || last.IndexOf(eds[2]) != len(last.editors)-1 {
+			t.Errorf("+Placement not placed at the bottom of the last column")
+		}
+
+		oldtop := last.editors[0]
+		ed, err := EditFind(testDir, "+PlacementTop", false, true)
+		if err != nil {
+			t.Errorf("opening +PlacementTop: %v", err)
+			return
+		}
+		defer closeEditor(ed)
+		if ed.Column() != last || last.IndexOf(ed) != 0 || last.IndexOf(oldtop) != 1 {
+			t.Errorf("+PlacementTop not placed at the top of the last column")
+		}
+		if ed.r.Max.Y > oldtop.r.Min.Y {
+			t.Errorf("+PlacementTop %v not above %v", ed.r, oldtop.r)
+		}
+	})
+
+	// moving an editor and restoring the layout puts it back where it was
+	var savedCol, savedIdx int
+	onMainLoop(func() {
+		LayoutCmd(ExecContext{}, "save placementtest")
+		savedCol = Wnd.cols.IndexOf(eds[1].Column())
+		savedIdx = eds[1].Column().IndexOf(eds[1])
+
+		col := eds[1].Column()
+		col.Remove(col.IndexOf(eds[1]))
+		dst := Wnd.cols.cols[(savedCol+1)%len(Wnd.cols.cols)]
+		dst.AddAfter(eds[1], -1, -1, true)
+	})
+	bs, err := ioutil.ReadFile(layoutPath("placementtest"))
+	if err != nil {
+		t.Fatalf("layout not saved: %v", err)
+	}
+	if !strings.HasPrefix(string(bs), "sz ") || !strings.Contains(string(bs), " "+src+" ") {
+		t.Fatalf("wrong layout file:\n%s", bs)
+	}
+
+	onMainLoop(func() {
+		LayoutCmd(ExecContext{}, "restore placementtest")
+		if col := Wnd.cols.IndexOf(eds[1].Column()); col != savedCol || eds[1].Column().IndexOf(eds[1]) != savedIdx {
+			t.Errorf("layout not restored, editor in column %d", col)
+		}
+	})
+}
+
+// Opens the files names in a new column at the end of the window, call the returned function to remove it
+func newTestColumn(t *testing.T, names ...string) (*Col, []*Editor, func()) {
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(testDir, name), []byte(name+"\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var col *Col
+	var eds []*Editor
+	onMainLoop(func() {
+		col = Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), -1, 0.4)
+		for _, name := range names {
+			ed, err := EditFind(testDir, name, false, true)
+			if err != nil {
+				t.Errorf("opening %s: %v", name, err)
+				return
+			}
+			oldcol := ed.Column()
+			oldcol.Remove(oldcol.IndexOf(ed))
+			col.AddAfter(ed, -1, -1, true)
+			eds = append(eds, ed)
+		}
+		setActive(eds[0], nil)
+	})
+	cleanup := func() {
+		onMainLoop(func() {
+			for _, ed := range eds {
+				closeEditor(ed)
+			}
+			Wnd.cols.Remove(Wnd.cols.IndexOf(col))
+		})
+	}
+	if len(eds) != len(names) {
+		cleanup()
+		t.FailNow()
+	}
+	return col, eds, cleanup
+}
+
+func TestStack(t *testing.T) {
+	col, eds, cleanup := newTestColumn(t, "stack1.txt", "stack2.txt", "stack3.txt")
+	defer cleanup()
+
+	coltag := func() string { return string(col.tagbuf.SelectionRunes(util.Sel{S: 0, E: col.tagbuf.Size()})) }
+	usertag := string(config.DefaultColumnTag)
+
+	check := func(cur int, tag string) {
+		t.Helper()
+		if got := coltag(); got != tag+" | "+usertag {
+			t.Errorf("wrong column tag %q", got)
+		}
+		for i, ed := range eds {
+			visible := !ed.r.Empty() && ed.r.In(col.r)
+			if visible != (i == cur) {
+				t.Errorf("editor %d visible %v (current %d)", i, visible, cur)
+			}
+		}
+		if eds[cur].size != col.contentArea() {
+			t.Errorf("current editor does not fill the column")
+		}
+	}
+
+	onMainLoop(func() {
+		StackCmd(ExecContext{col: col}, "")
+		check(0, "[stack1.txt] stack2.txt stack3.txt")
+
+		StackCmd(ExecContext{col: col}, "next")
+		check(1, "stack1.txt [stack2.txt] stack3.txt")
+
+		StackCmd(ExecContext{col: col}, "prev")
+		StackCmd(ExecContext{col: col}, "prev")
+		check(2, "stack1.txt stack2.txt [stack3.txt]")
+
+		// clicking on a tab
+		if ed := col.tabAt(len("stack1.txt ") + 2); ed != eds[1] {
+			t.Errorf("wrong editor for tab")
+		}
+
+		// opening a hidden editor shows it
+		EditFind(testDir, "stack1.txt", false, false)
+		check(0, "[stack1.txt] stack2.txt stack3.txt")
+
+		StackCmd(ExecContext{col: col}, "")
+		if got := coltag(); got != usertag {
+			t.Errorf("wrong column tag after unstacking %q", got)
+		}
+		for i, ed := range eds {
+			if ed.size <= ed.MinHeight() {
+				t.Errorf("editor %d collapsed after unstacking", i)
+			}
+		}
+	})
+}
+
+func TestWindowCommands(t *testing.T) {
+	col, eds, cleanup := newTestColumn(t, "wm1.txt", "wm2.txt", "wm3.txt")
+	defer cleanup()
+
+	sizes := func() []int {
+		r := []int{}
+		for _, ed := range eds {
+			r = append(r, ed.size)
+		}
+		return r
+	}
+	lh := TagHeight(&eds[0].tagfr)
+
+	onMainLoop(func() {
+		EqualizeCmd(ExecContext{col: col}, "")
+		before := sizes()
+		if before[0] != before[1] {
+			t.Errorf("editors not equalized: %v", before)
+		}
+
+		GrowCmd(ExecContext{ed: eds[1]}, "2")
+		if after := sizes(); after[1] != before[1]+2*lh {
+			t.Errorf("editor did not grow by two lines: %v -> %v", before, after)
+		}
+		EqualizeCmd(ExecContext{col: col}, "")
+
+		ShrinkCmd(ExecContext{ed: eds[1]}, "1")
+		if after := sizes(); after[1] != before[1]-lh || after[2] != before[2]+lh {
+			t.Errorf("editor did not shrink by one line: %v -> %v", before, after)
+		}
+
+		beforeMax := sizes()
+		MaximizeCmd(ExecContext{ed: eds[0]}, "")
+		if eds[1].size != eds[1].MinHeight() || eds[2].size != eds[2].MinHeight() {
+			t.Errorf("editor not maximized: %v", sizes())
+		}
+		MaximizeCmd(ExecContext{ed: eds[0]}, "")
+		if fmt.Sprint(sizes()) != fmt.Sprint(beforeMax) {
+			t.Errorf("sizes not restored: %v -> %v", beforeMax, sizes())
+		}
+
+		FocusCmd(ExecContext{ed: eds[0]}, "down")
+		if activeEditor != eds[1] {
+			t.Errorf("focus did not move down")
+		}
+		FocusCmd(ExecContext{ed: eds[1]}, "left")
+		if activeEditor == eds[1] || activeEditor.Column() != Wnd.cols.cols[len(Wnd.cols.cols)-2] {
+			t.Errorf("focus did not move left")
+		}
+
+		MovecolCmd(ExecContext{ed: eds[2]}, "prev")
+		if eds[2].Column() == col || activeEditor != eds[2] {
+			t.Errorf("editor not moved to the previous column")
+		}
+		MovecolCmd(ExecContext{ed: eds[2]}, "next")
+		if eds[2].Column() != col {
+			t.Errorf("editor not moved back")
+		}
+	})
+}
+
+func TestJumpHistory(t *testing.T) {
+	src := filepath.Join(testDir, "jump1.txt")
+	dst := filepath.Join(testDir, "jump2.txt")
+	if err := ioutil.WriteFile(src, []byte("see jump2.txt:3\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, []byte("one\ntwo\nthree\nfour\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	oldRules := config.LoadRules
+	config.LoadRules = []util.LoadRule{{BufRe: `.`, Re: `([^:\s]+):(\d+)`, Action: "L$1:$2"}}
+	defer func() {
+		config.LoadRules = oldRules
+		onMainLoop(LoadInit)
+	}()
+
+	var ed1, ed2 *Editor
+	onMainLoop(func() {
+		LoadInit()
+		jumpHistory, jumpCur = nil, 0
+
+		var err error
+		ed1, err = EditFind(testDir, "jump1.txt", false, false)
+		if err != nil {
+			t.Errorf("opening %s: %v", src, err)
+			return
+		}
+		ed1.sfr.Fr.Sel = util.Sel{S: 0, E: ed1.bodybuf.Size() - 1}
+		Load(ExecContext{ed: ed1, dir: testDir, fr: &ed1.sfr.Fr, buf: ed1.bodybuf, br: ed1.BufferRefresh}, 6)
+		ed2 = openEditorFor(dst)
+	})
+	if ed1 == nil || ed2 == nil {
+		t.Fatalf("load rule did not open %s", dst)
+	}
+	defer onMainLoop(func() {
+		for _, path := range []string{src, dst} {
+			if ed := openEditorFor(path); ed != nil {
+				closeEditor(ed)
+			}
+		}
+	})
+
+	line := func(ed *Editor) int {
+		ln, _ := ed.bodybuf.GetLine(ed.sfr.Fr.Sel.S)
+		return ln
+	}
+
+	onMainLoop(func() {
+		if line(ed2) != 3 {
+			t.Errorf("load went to line %d", line(ed2))
+		}
+
+		BackCmd(ExecContext{ed: ed2}, "")
+		if activeEditor != ed1 || ed1.sfr.Fr.Sel.S != 0 {
+			t.Errorf("Back did not return to %s", src)
+		}
+
+		ForwardCmd(ExecContext{ed: ed1}, "")
+		if activeEditor != ed2 || line(ed2) != 3 {
+			t.Errorf("Forward did not return to %s:3", dst)
+		}
+
+		// closed files are reopened
+		closeEditor(ed1)
+		BackCmd(ExecContext{ed: ed2}, "")
+		if ed := openEditorFor(src); ed == nil || activeEditor != ed || ed.sfr.Fr.Sel.S != 0 {
+			t.Errorf("Back did not reopen %s", src)
+		}
+	})
+}
+
+func TestBookmarks(t *testing.T) {
+	path := filepath.Join(testDir, "bookmarks.txt")
+	wd, _ := os.Getwd()
+	marksPath := filepath.Join(wd, "+Marks")
+	if err := ioutil.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer onMainLoop(func() {
+		for _, p := range []string{path, marksPath} {
+			if ed := openEditorFor(p); ed != nil {
+				closeEditor(ed)
+			}
+		}
+		BookmarksInit()
+	})
+
+	onMainLoop(func() {
+		ed, err := EditFind(testDir, "bookmarks.txt", false, false)
+		if err != nil {
+			t.Errorf("opening %s: %v", path, err)
+			return
+		}
+		ec := ExecContext{ed: ed, fr: &ed.sfr.Fr, buf: ed.bodybuf, br: ed.BufferRefresh}
+		ed.sfr.Fr.Sel = util.Sel{8, 8}
+		MarkCmd(ec, "third")
+
+		// the bookmark follows insertions above it
+		sel := util.Sel{0, 0}
+		ed.bodybuf.Replace([]rune("zero\n"), &sel, true, nil, 0)
+		ed.sfr.Fr.Sel = util.Sel{0, 0}
+		if got := edit.AddrEval("'third", ed.bodybuf, ed.sfr.Fr.Sel); got.S != 13 || got.E != 13 {
+			t.Errorf("'third evaluated to %v", got)
+		}
+
+		// the bookmarks file has the position in the file on disk until the buffer is saved
+		saved := func() string {
+			bs, _ := ioutil.ReadFile(bookmarksPath())
+			return string(bs)
+		}
+		saveBookmarks()
+		if got := saved(); got != "third\t8\t8\t"+path+"\n" {
+			t.Errorf("wrong bookmarks file before saving %q", got)
+		}
+		if err := ed.bodybuf.Put(); err != nil {
+			t.Errorf("saving %s: %v", path, err)
+		}
+		saveBookmarksOf(path)
+		if got := saved(); got != "third\t13\t13\t"+path+"\n" {
+			t.Errorf("wrong bookmarks file after saving %q", got)
+		}
+
+		MarksCmd(ec, "")
+		marksed := openEditorFor(marksPath)
+		if marksed == nil {
+			t.Errorf("+Marks not opened")
+			return
+		}
+		if body := string(marksed.bodybuf.SelectionRunes(util.Sel{0, marksed.bodybuf.Size()})); body != path+":4\tthird\n" {
+			t.Errorf("wrong +Marks content %q", body)
+		}
+
+		// bookmarks are restored from the bookmarks file and files are reopened when needed
+		closeEditor(ed)
+		BookmarksInit()
+		JumpCmd(ExecContext{ed: marksed}, "third")
+		ed = openEditorFor(path)
+		if ed == nil || activeEditor != ed || ed.sfr.Fr.Sel.S != 13 {
+			t.Errorf("Jump did not reopen %s at the bookmark", path)
+			return
+		}
+
+		// bookmarks set while the buffer is modified are saved too
+		sel = util.Sel{0, 0}
+		ed.bodybuf.Replace([]rune("x\n"), &sel, true, nil, 0)
+		ed.sfr.Fr.Sel = util.Sel{21, 21}
+		MarkCmd(ExecContext{ed: ed, fr: &ed.sfr.Fr, buf: ed.bodybuf, br: ed.BufferRefresh}, "fourth")
+		saveBookmarks()
+		if got := saved(); got != "third\t13\t13\t"+path+"\nfourth\t21\t21\t"+path+"\n" {
+			t.Errorf("wrong bookmarks file with a bookmark set while modified %q", got)
+		}
+
+		MarkCmd(ExecContext{ed: ed}, "-d third")
+		MarkCmd(ExecContext{ed: ed}, "-d fourth")
+		if findBookmark(ed, "third") != nil || findBookmark(ed, "fourth") != nil {
+			t.Errorf("bookmark not deleted")
+		}
+	})
+}
+
+func TestFold(t *testing.T) {
+	_, eds, cleanup := newTestColumn(t, "fold.txt")
+	defer cleanup()
+	ed := eds[0]
+	ec := ExecContext{ed: ed, fr: &ed.sfr.Fr, buf: ed.bodybuf, br: ed.BufferRefresh}
+
+	const body = "func a() {\n\tx := 1\n\ty := 2\n}\n\nfunc b() {\n\tz := 3\n}\n"
+	folds := func() string { return fmt.Sprint(ed.sfr.Fr.Folds) }
+
+	onMainLoop(func() {
+		ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+		ed.bodybuf.Replace([]rune(body), &ed.sfr.Fr.Sel, true, nil, 0)
+		ed.sfr.Fr.Sel = util.Sel{0, 0}
+		ed.BufferRefresh()
+
+		FoldCmd(ec, "")
+		if folds() != "[{10 27}]" {
+			t.Errorf("wrong folds after Fold %s", folds())
+		}
+		// the hidden lines take no space
+		if p0, p1, p2 := ed.sfr.Fr.PointToCoord(0), ed.sfr.Fr.PointToCoord(12), ed.sfr.Fr.PointToCoord(26); p1 != p2 || p0.Y != p2.Y {
+			t.Errorf("folded text is visible %v %v %v", p0, p1, p2)
+		}
+
+		// folds follow edits
+		sel := util.Sel{0, 0}
+		ed.bodybuf.Replace([]rune("// c\n"), &sel, true, nil, 0)
+		ed.BufferRefresh()
+		if folds() != "[{15 32}]" {
+			t.Errorf("wrong folds after edit %s", folds())
+		}
+
+		// moving the cursor inside a fold opens it
+		ed.sfr.Fr.Sel = util.Sel{20, 20}
+		ed.BufferRefresh()
+		if folds() != "[]" {
+			t.Errorf("fold not opened %s", folds())
+		}
+
+		ed.sfr.Fr.Sel = util.Sel{0, 0}
+		FoldCmd(ec, "all")
+		if folds() != "[{15 32} {45 54}]" {
+			t.Errorf("wrong folds after Fold all %s", folds())
+		}
+		ed.sfr.Fr.Sel = util.Sel{45, 45}
+		UnfoldCmd(ec, "")
+		if folds() != "[{15 32}]" {
+			t.Errorf("wrong folds after Unfold %s", folds())
+		}
+		UnfoldCmd(ec, "all")
+		if folds() != "[]" {
+			t.Errorf("wrong folds after Unfold all %s", folds())
+		}
+	})
+}
+
+func TestOutline(t *testing.T) {
+	_, eds, cleanup := newTestColumn(t, "outline.go")
+	defer cleanup()
+	ed := eds[0]
+	outlinePath := filepath.Join(testDir, "+Outline")
+	defer onMainLoop(func() {
+		if outed := openEditorFor(outlinePath); outed != nil {
+			closeEditor(outed)
+		}
+	})
+
+	outlineBody := func() string {
+		outed := openEditorFor(outlinePath)
+		if outed == nil {
+			return ""
+		}
+		return string(outed.bodybuf.SelectionRunes(util.Sel{0, outed.bodybuf.Size()}))
+	}
+
+	onMainLoop(func() {
+		ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+		ed.bodybuf.Replace([]rune("package p\n\ntype T struct{}\n\nfunc (t *T) M() {}\n\nfunc F() {}\n"), &ed.sfr.Fr.Sel, true, nil, 0)
+		OutlineCmd(ExecContext{ed: ed}, "")
+		if body, tgt := outlineBody(), "outline.go:3\ttype T struct\noutline.go:5\tfunc (*T) M\noutline.go:7\tfunc F\n"; body != tgt {
+			t.Errorf("wrong outline %q", body)
+		}
+
+		// the outline is updated when the file is saved
+		sel := util.Sel{ed.bodybuf.Size(), ed.bodybuf.Size()}
+		ed.bodybuf.Replace([]rune("\nfunc G() {}\n"), &sel, true, nil, 0)
+		PutCmd(ExecContext{ed: ed}, "")
+		if body := outlineBody(); !strings.HasSuffix(body, "outline.go:9\tfunc G\n") {
+			t.Errorf("outline not updated %q", body)
+		}
+
+		// a header on a last line without a newline
+		ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+		ed.bodybuf.Replace([]rune("package p\n\ntype T"), &ed.sfr.Fr.Sel, true, nil, 0)
+		if entries := headerOutline(ed.bodybuf); fmt.Sprint(entries) != "[{3 type T}]" {
+			t.Errorf("wrong header outline %v", entries)
+		}
+	})
+
+	// other languages are outlined through the header highlighting rules
+	tests := []struct {
+		name, src, out string
+	}{
+		{"outline.py", "import os\n\nclass A:\n    def m(self):\n        pass\n\ndef f(x):\n    return x\n", "3\tclass A\n4\tdef m(self)\n7\tdef f(x)\n"},
+		{"outline.c", "#include <stdio.h>\n\nstruct point {\n\tint x, y;\n};\n\nstatic int *f(int x) {\n\tprintf(\"%d\", x);\n\treturn g(x);\n}\n", "3\tstruct point\n7\tstatic int *f(int x)\n"},
+		{"outline.java", "public class A {\n    private int n;\n    public static void main(String[] args) {\n        run(args);\n    }\n}\n", "1\tpublic class A\n2\tprivate int n;\n3\tpublic static void main(String[] args)\n"},
+		{"outline.js", "export async function f(x) {\n  return g(x);\n}\nclass B {}\n", "1\texport async function f(x)\n4\tclass B {}\n"},
+		{"outline.lua", "local function f(x)\n  return g(x)\nend\nfunction M.h()\nend\n", "1\tlocal function f(x)\n4\tfunction M.h()\n"},
+		{"outline.md", "# Title\n\ntext\n\n## Section\n", "1\t# Title\n5\t## Section\n"},
+	}
+	names := make([]string, len(tests))
+	for i := range tests {
+		names[i] = tests[i].name
+	}
+	_, langeds, langcleanup := newTestColumn(t, names...)
+	defer langcleanup()
+	onMainLoop(func() {
+		for i, tc := range tests {
+			led := langeds[i]
+			led.sfr.Fr.Sel = util.Sel{0, led.bodybuf.Size()}
+			led.bodybuf.Replace([]rune(tc.src), &led.sfr.Fr.Sel, true, nil, 0)
+			OutlineCmd(ExecContext{ed: led}, "")
+			tgt := ""
+			for _, line := range strings.SplitAfter(tc.out, "\n") {
+				if line != "" {
+					tgt += tc.name + ":" + line
+				}
+			}
+			if body := outlineBody(); body != tgt {
+				t.Errorf("wrong outline of %s %q", tc.name, body)
+			}
+		}
+	})
+}
+
+func TestHistory(t *testing.T) {
+	oldHistoryFile := config.HistoryFile
+	config.HistoryFile = filepath.Join(testDir, "history-test")
+	defer func() { config.HistoryFile = oldHistoryFile }()
+	os.Remove(config.HistoryFile)
+
+	when := time.Date(2020, 1, 2, 3, 4, 0, 0, time.Local)
+	entries := []HistoryEntry{
+		{when, "Edit ,x/a\nb/ d", "/src"},
+		{when, "mk", "/src"},
+		{when, `Edit s/\n/x/`, "/other"},
+		{when, "mk", "/src"},
+	}
+	for _, h := range entries {
+		historyAppend(h)
+	}
+
+	// multi-line commands are read back as they were executed
+	if read := historyRead(); fmt.Sprint(read) != fmt.Sprint(entries) {
+		t.Errorf("history not read back\n%v\n%v", read, entries)
+	}
+
+	// repeated commands are listed once, at the position of their last execution
+	shown := historyShown(historyRead(), nil)
+	if tgt := []string{`Edit ,x/a\nb/ d ### /src`, `Edit s/\\n/x/ ### /other`, "mk ### /src"}; fmt.Sprint(shown) != fmt.Sprint(tgt) {
+		t.Errorf("wrong +History %q", shown)
+	}
+	for i, line := range shown {
+		cmd, dir, ok := historyLineSplit(line)
+		if j := []int{0, 2, 3}[i]; !ok || cmd != entries[j].Cmd || dir != entries[j].Dir {
+			t.Errorf("line %q split into %q %q", line, cmd, dir)
+		}
+	}
+
+	if shown := historyShown(historyRead(), regexp.MustCompile("other")); fmt.Sprint(shown) != fmt.Sprint([]string{`Edit s/\\n/x/ ### /other`}) {
+		t.Errorf("wrong filtered +History %q", shown)
+	}
+
+	for i := 0; i < maxHistoryShown+10; i++ {
+		historyAppend(HistoryEntry{when, fmt.Sprintf("cmd%d", i), "/src"})
+	}
+	shown = historyShown(historyRead(), nil)
+	if len(shown) != maxHistoryShown || shown[0] != "cmd10 ### /src" || shown[len(shown)-1] != fmt.Sprintf("cmd%d ### /src", maxHistoryShown+9) {
+		t.Errorf("wrong trimmed +History %d %q %q", len(shown), shown[0], shown[len(shown)-1])
+	}
+}
+
+func TestDefaultWorkspaceName(t *testing.T) {
+	a, b := defaultWorkspaceName("/home/user/a/api"), defaultWorkspaceName("/home/user/b/api")
+	if a == b {
+		t.Errorf("projects with the same directory name share workspace %s", a)
+	}
+	if !strings.HasPrefix(a, "api-") || strings.ContainsAny(a, "/ \t") {
+		t.Errorf("bad workspace name %q", a)
+	}
+}
+
+func TestDumpSels(t *testing.T) {
+	path := filepath.Join(testDir, "dumpsels.txt")
+	if err := ioutil.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	onMainLoop(func() {
+		ed, err := EditFind(testDir, "dumpsels.txt", false, false)
+		if err != nil {
+			t.Errorf("opening %s: %v", path, err)
+			return
+		}
+		defer closeEditor(ed)
+
+		ed.sfr.Fr.Sel = util.Sel{S: 4, E: 7}
+		ed.otherSel[OS_MARK] = util.Sel{S: 8, E: 8}
+		ed.pushJump(util.Sel{S: 2, E: 2})
+		ed.pushJump(util.Sel{S: 14, E: 14})
+
+		bs, err := json.Marshal(ed.Dump(map[string]int{path: 0}, 100))
+		if err != nil {
+			t.Errorf("encoding dump: %v", err)
+			return
+		}
+		var de DumpEditor
+		if err := json.Unmarshal(bs, &de); err != nil {
+			t.Errorf("decoding dump: %v", err)
+			return
+		}
+
+		ned := NewEditor(ed.bodybuf)
+		col := ed.Column()
+		col.AddAfter(ned, col.IndexOf(ed), -1, false)
+		defer closeEditor(ned)
+		ned.restoreDumpSels(de)
+
+		if ned.sfr.Fr.Sel != (util.Sel{S: 4, E: 7}) || ned.otherSel[OS_MARK] != (util.Sel{S: 8, E: 8}) {
+			t.Errorf("selections not restored: %v %v", ned.sfr.Fr.Sel, ned.otherSel)
+		}
+		if fmt.Sprint(ned.jumps) != fmt.Sprint(ed.jumps) || ned.restoredJump != ed.restoredJump {
+			t.Errorf("jump ring not restored: %v %d (expected %v %d)", ned.jumps, ned.restoredJump, ed.jumps, ed.restoredJump)
+		}
+
+		// without a jump history Back cycles through the restored ring
+		saved, savedCur := jumpHistory, jumpCur
+		jumpHistory, jumpCur = nil, 0
+		defer func() { jumpHistory, jumpCur = saved, savedCur }()
+		for _, exp := range []int{14, 2, 14} {
+			BackCmd(ExecContext{ed: ned}, "")
+			if ned.sfr.Fr.Sel.S != exp {
+				t.Errorf("Back moved to %d, expected %d", ned.sfr.Fr.Sel.S, exp)
+			}
+		}
+	})
+}
+
+func TestRecoverSkipsLiveOwners(t *testing.T) {
+	live := exec.Command("sleep", "10")
+	if err := live.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer live.Process.Kill()
+	dead := exec.Command("true")
+	if err := dead.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	os.MkdirAll(recoverDir(), 0700)
+	livePath, deadPath := filepath.Join(testDir, "recover-live.txt"), filepath.Join(testDir, "recover-dead.txt")
+	for path, pid := range map[string]int{livePath: live.Process.Pid, deadPath: dead.ProcessState.Pid()} {
+		ioutil.WriteFile(recoverPath(path)+recoverOwnerExt, []byte(strconv.Itoa(pid)), 0600)
+		ioutil.WriteFile(recoverPath(path), []byte("unsaved\n"), 0600)
+		defer recoverRemove(path)
+	}
+
+	var candidates []string
+	onMainLoop(func() { candidates = recoverCandidates() })
+	if fmt.Sprint(candidates) != fmt.Sprint([]string{deadPath}) {
+		t.Errorf("wrong recovery candidates %v", candidates)
+	}
+}
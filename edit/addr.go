@@ -184,6 +184,19 @@ func (e *AddrBase) Eval(b *buf.Buffer, sel util.Sel) (rsel util.Sel) {
 		rsel.S = b.Size()
 		rsel.E = rsel.S
 
+	case "'":
+		if e.Dir != 0 {
+			panic(fmt.Errorf("Bad address syntax, non-absolute bookmark"))
+		}
+		ok := false
+		if Bookmarkfn != nil {
+			rsel, ok = Bookmarkfn(b, e.Value)
+		}
+		if !ok {
+			panic(fmt.Errorf("No bookmark named: %s", e.Value))
+		}
+		b.FixSel(&rsel)
+
 	case "?":
 		rsel = setStartSel(-e.Dir, sel)
 		rsel = regexpEval(b, rsel, e.Value, -e.Dir)
@@ -13,6 +13,7 @@ import (
 
 var Warnfn func(msg string)
 var NewJob func(wd, Cmd, input string, buf *buf.Buffer, resultChan chan<- string)
+var Bookmarkfn func(b *buf.Buffer, name string) (util.Sel, bool)
 
 const LOOP_LIMIT = 2000
 
@@ -116,7 +117,7 @@ func scmdfn(c *Cmd, ec *EditContext) {
 		}
 		sel = util.Sel{loc[0], loc[1]}
 		if globalrepl || (c.numarg == nmatch) {
-			realSubs := resolveBackreferences(subs, ec.Buf, loc)
+			realSubs := ResolveBackreferences(subs, ec.Buf, loc)
 			ec.Buf.Replace(realSubs, &sel, first, ec.EventChan, util.EO_MOUSE)
 			if !globalrepl {
 				break
@@ -138,7 +139,8 @@ func scmdfn(c *Cmd, ec *EditContext) {
 	}
 }
 
-func resolveBackreferences(subs []rune, b *buf.Buffer, loc []int) []rune {
+// Replaces \1 ... \9 in subs with the corresponding submatches of loc, panics if subs refers to a submatch that doesn't exist
+func ResolveBackreferences(subs []rune, b *buf.Buffer, loc []int) []rune {
 	var r []rune = nil
 	initR := func(src int) {
 		r = make([]rune, src, len(subs))
@@ -293,8 +295,9 @@ func pipecmdfn(c *Cmd, ec *EditContext) {
 	resultChan := make(chan string)
 	NewJob(ec.Buf.Dir, c.bodytxt, str, ec.Buf, resultChan)
 	str = <-resultChan
-	ec.Buf.Replace([]rune(str), ec.atsel, ec.Buf.EditMark, ec.EventChan, util.EO_MOUSE)
-	ec.Buf.EditMark = ec.Buf.EditMarkNext
+	if ec.Buf.ReplaceMinimal([]rune(str), ec.atsel, ec.Buf.EditMark, ec.EventChan, util.EO_MOUSE) {
+		ec.Buf.EditMark = ec.Buf.EditMarkNext
+	}
 }
 
 func kcmdfn(c *Cmd, ec *EditContext) {
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/hl"
 	"github.com/aarzilli/yacco/util"
 )
 
@@ -18,7 +19,7 @@ func testEdit(t *testing.T, input, pgm, target string) {
 	e := strings.Index(input, ">")
 	input = input[:e] + input[e+1:]
 
-	buf, _ := buf.NewBuffer("/", "+Tag", true, " ")
+	buf, _ := buf.NewBuffer("/", "+Tag", true, " ", hl.NilHighlighter)
 	buf.Replace([]rune(input), &util.Sel{0, 0}, true, nil, util.EO_MOUSE)
 
 	sel := util.Sel{s, e}
@@ -80,3 +81,34 @@ func TestRegexpAddrCmd(t *testing.T) {
 func TestSemicolon(t *testing.T) {
 	testEdit(t, "re blah <blah> re blah", "-#0;+#1", "re blah <b>lah re blah")
 }
+
+func testEditError(t *testing.T, input, pgm, tgterr string) {
+	defer func() {
+		ierr := recover()
+		if ierr == nil {
+			t.Fatalf("no error executing [%s]", pgm)
+		}
+		if err := ierr.(error); !strings.Contains(err.Error(), tgterr) {
+			t.Fatalf("wrong error executing [%s]: %v", pgm, err)
+		}
+	}()
+	testEdit(t, input, pgm, "")
+}
+
+func TestBookmarkAddr(t *testing.T) {
+	Bookmarkfn = func(b *buf.Buffer, name string) (util.Sel, bool) {
+		if name == "a" {
+			return util.Sel{4, 7}, true
+		}
+		return util.Sel{}, false
+	}
+	defer func() { Bookmarkfn = nil }()
+
+	testEdit(t, "uno <>due tre", "'a", "uno <due> tre")
+	testEdit(t, "<>uno due tre", "'a,$", "uno <due tre>")
+	testEdit(t, "<>uno due\ntre", "'a+1", "uno due\n<tre>")
+
+	testEditError(t, "<>uno due tre", "+'a", "non-absolute bookmark")
+	testEditError(t, "<>uno due tre", "'b", "No bookmark named: b")
+	testEditError(t, "<>uno due tre", "'", "Missing bookmark name")
+}
@@ -31,6 +31,22 @@ func TestAddrs(t *testing.T) {
 	testParsed(t, "/regexp/", "Range<+/regexp> Cmd< >")
 }
 
+func TestBookmarkAddrs(t *testing.T) {
+	testParsed(t, "'a", "Range<'a> Cmd< >")
+	testParsed(t, "'mark_1,'b2", "Range<Op<'mark_1 , 'b2>> Cmd< >")
+	testParsed(t, "'a+/regexp/", "Range<List<'a +/regexp >> Cmd< >")
+	testParsed(t, "+'a", "Range<List<. +'a >> Cmd< >")
+
+	func() {
+		defer func() {
+			if ierr := recover(); ierr == nil {
+				t.Fatalf("bookmark without a name accepted")
+			}
+		}()
+		Parse([]rune("'"))
+	}()
+}
+
 func TestAddrless(t *testing.T) {
 	testParsed(t, "c/test/", "Range<.> Cmd<c> Arg<test>")
 }
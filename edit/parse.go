@@ -261,6 +261,13 @@ func readAddressTok(pgm []rune) (addrTok, []rune) {
 		rx, rest := readDelim(pgm[1:], pgm[0], false)
 		return addrTok(fmt.Sprintf("%c%s%c", pgm[0], rx, pgm[0])), rest
 
+	case '\'': // bookmark
+		n, rest := readName(pgm[1:])
+		if n == "" {
+			panic(fmt.Errorf("Missing bookmark name while parsing <%s>", string(pgm)))
+		}
+		return addrTok("'" + n), rest
+
 	case '#':
 		if (len(pgm) >= 2) && ((pgm[1] == 'w') || (pgm[1] == '?')) {
 			n, rest := readNumber(pgm[2:])
@@ -287,6 +294,15 @@ func readNumber(rest []rune) (string, []rune) {
 	return string(rest), []rune{}
 }
 
+func readName(rest []rune) (string, []rune) {
+	for i := range rest {
+		if !unicode.IsLetter(rest[i]) && !unicode.IsDigit(rest[i]) && rest[i] != '_' {
+			return string(rest[:i]), rest[i:]
+		}
+	}
+	return string(rest), []rune{}
+}
+
 func readDelim(pgm []rune, endr rune, unescape bool) (string, []rune) {
 	r := []rune{}
 	escaping := false
@@ -456,6 +472,10 @@ func parseAddrBase(addrs []addrTok) (Addr, []addrTok) {
 			return &AddrBase{"", f, 0}, addrs[1:]
 		}
 
+		if f[0] == '\'' {
+			return &AddrBase{"'", f[1:], 0}, addrs[1:]
+		}
+
 		if f[0] == '/' || f[0] == '?' {
 			return &AddrBase{string(f[0]), f[1 : len(f)-1], +1}, addrs[1:]
 		}
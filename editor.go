@@ -39,13 +39,16 @@ type Editor struct {
 
 	eventChan        chan string
 	eventChanSpecial bool
+	specialTag       string // commands added to the tag while eventChanSpecial is set
 	eventReader      util.EventReader
 	noAutocompl      bool
 
 	pw int
 
 	otherSel     []util.Sel
-	restoredJump int
+	jumps        []util.Sel  // ring of the last NUM_JUMPS positions jumps left this editor from, S < 0 for unused entries
+	restoredJump int         // index in jumps of the position Back restores when there is no jump history
+	folds        []*util.Sel // folded regions of bodybuf, see fold.go
 
 	refreshOpt struct {
 		top         int
@@ -55,6 +58,23 @@ type Editor struct {
 
 	redrawRects []image.Rectangle
 	closed      bool
+
+	scrollLock struct {
+		ed       *Editor       // editor this one scrolls together with
+		align    func(int) int // maps a line of this editor to the corresponding line of ed
+		top      int
+		revCount int
+	}
+
+	highlight struct {
+		needle   []rune // visible matches of needle are highlighted
+		opts     lookOpts
+		matcher  *lookMatcher
+		word     bool // needle is the word under the cursor
+		top      int  // top, size and revCount of the frame when highlights were last computed
+		size     int
+		revCount int
+	}
 }
 
 const NUM_JUMPS = 7
@@ -69,6 +89,16 @@ const (
 
 const PMATCHSEL = 3
 
+func init() {
+	buf.EventHook = bufferEvent
+}
+
+// Called for every change to a buffer
+func bufferEvent(b *buf.Buffer, origin util.EventOrigin, etype util.EventType, s, e int, text string) {
+	watchBufferEvent(b, origin, etype, s, e, text)
+	snippetBufferEvent(b, origin, etype, s, e, text)
+}
+
 func (e *Editor) SetWnd(wnd *Window) {
 	e.sfr.Flush = wnd.FlushImage
 	e.sfr.Fr.Flush = wnd.FlushImage
@@ -113,6 +143,12 @@ func NewEditor(bodybuf *buf.Buffer) *Editor {
 
 	e.otherSel[OS_MARK] = util.Sel{-1, -1}
 	e.otherSel[OS_TOP].E = 0
+	e.jumps = make([]util.Sel, NUM_JUMPS)
+	for i := range e.jumps {
+		e.jumps[i] = util.Sel{-1, -1}
+	}
+
+	attachBookmarks(bodybuf)
 
 	bodybuf.Props["font"] = Wnd.Prop["font"]
 	if bodybuf.Props["font"] == "alt" {
@@ -120,6 +156,7 @@ func NewEditor(bodybuf *buf.Buffer) *Editor {
 	} else {
 		e.sfr.Fr.Font = config.MainFont
 	}
+	e.framePropTrigger()
 
 	util.Must(e.sfr.Init(5), "Editor initialization failed")
 	util.Must(e.tagfr.Init(5), "Editor initialization failed")
@@ -138,6 +175,9 @@ func NewEditor(bodybuf *buf.Buffer) *Editor {
 	for i := range e.otherSel {
 		e.bodybuf.AddSel(&e.otherSel[i])
 	}
+	for i := range e.jumps {
+		e.bodybuf.AddSel(&e.jumps[i])
+	}
 
 	e.eventReader.Reset()
 
@@ -171,6 +211,13 @@ func (e *Editor) SetRects(b draw.Image, r image.Rectangle, last bool, simpleReca
 	e.last = last
 	e.r = r
 
+	if e.hidden() {
+		e.tagfr.R, e.tagfr.B = r, b
+		e.rhandle = r
+		e.sfr.SetRects(b, r)
+		return
+	}
+
 	th := TagHeight(&e.tagfr)
 
 	// TAG
@@ -227,9 +274,20 @@ func (e *Editor) Close() {
 	for i := range e.otherSel {
 		e.bodybuf.RmSel(&e.otherSel[i])
 	}
+	for i := range e.jumps {
+		e.bodybuf.RmSel(&e.jumps[i])
+	}
+	for _, fold := range e.folds {
+		e.bodybuf.RmSel(fold)
+	}
 	debug.FreeOSMemory()
 }
 
+// Returns true if the editor isn't shown, see Col.recalcStacked
+func (e *Editor) hidden() bool {
+	return e.r.Empty()
+}
+
 func (e *Editor) MinHeight() int {
 	return TagHeight(&e.tagfr) + 2
 }
@@ -256,6 +314,9 @@ func (e *Editor) redrawResizeHandle() {
 }
 
 func (e *Editor) Redraw() {
+	if e.hidden() {
+		return
+	}
 	e.redrawResizeHandle()
 
 	// draw text frames
@@ -308,6 +369,7 @@ func (e *Editor) GenTag() bool {
 	if e.bodybuf.IsDir() {
 		t += " Get"
 	}
+	t += e.specialTag
 
 	t += " | " + usertext
 
@@ -340,15 +402,19 @@ func (e *Editor) refreshIntl(full bool) {
 	- buffer RevCount is the same as the last time we were here
 	- don't reload the buffer, just let the redraw happen (in this situation we could also do a minimal redraw)
 	*/
+	if e.syncFolds() {
+		full = true
+	}
 	if !full && (e.otherSel[OS_TOP].E == e.refreshOpt.top) && (e.bodybuf.RevCount == e.refreshOpt.revCount) {
 		return
 	}
 	e.refreshOpt.top = e.otherSel[OS_TOP].E
 
-	e.sfr.Fr.Clear()
-	e.sfr.Set(e.otherSel[OS_TOP].E, e.bodybuf.Size())
 	e.bodybuf.Rdlock()
 	defer e.bodybuf.Rdunlock()
+	edutil.UpdateGutter(e.bodybuf, &e.otherSel[OS_TOP], &e.sfr)
+	e.sfr.Fr.Clear()
+	e.sfr.Set(e.otherSel[OS_TOP].E, e.bodybuf.Size())
 	e.sfr.Fr.Insert(e.bodybuf.Selection(util.Sel{e.otherSel[OS_TOP].E, e.bodybuf.Size()}))
 
 	e.refreshOpt.revCount = e.bodybuf.RevCount
@@ -357,6 +423,9 @@ func (e *Editor) refreshIntl(full bool) {
 }
 
 func (e *Editor) TagRefresh() {
+	if e.hidden() {
+		return
+	}
 	e.tagRefreshIntl()
 
 	ly := e.tagfr.LimitY() + e.tagfr.Font.Metrics().Descent.Floor()
@@ -390,6 +459,14 @@ func (e *Editor) badTop() bool {
 }
 
 func (e *Editor) BufferRefreshEx(recur, scroll bool) {
+	if e.hidden() {
+		// refreshed by SetRects when it is shown
+		if recur {
+			e.refreshSameBuffer()
+		}
+		return
+	}
+
 	// adjust matching parenthesis highlight
 	match := findPMatch(e.tagbuf, e.tagfr.Sel)
 	if match.S >= 0 {
@@ -424,6 +501,9 @@ func (e *Editor) BufferRefreshEx(recur, scroll bool) {
 		e.sfr.Redraw(true, nil) // NEEDED, otherwise every other redraw is optimized and is not performed correctly
 		edutil.Scrollfn(e.bodybuf, &e.otherSel[OS_TOP], &e.sfr, -1, e.sfr.Fr.LineNo()/4-1)
 	}
+	if scroll && e.sfr.Fr.HScrollTo(e.sfr.Fr.Sel.E) {
+		e.refreshIntl(true)
+	}
 
 	// redraw
 	if e.GenTag() {
@@ -441,6 +521,11 @@ func (e *Editor) BufferRefreshEx(recur, scroll bool) {
 		return
 	}
 
+	e.refreshSameBuffer()
+}
+
+// Refreshes the other editors of the buffer of e
+func (e *Editor) refreshSameBuffer() {
 	for _, col := range Wnd.cols.cols {
 		for _, oe := range col.editors {
 			if (oe.bodybuf == e.bodybuf) && (oe != e) {
@@ -450,6 +535,14 @@ func (e *Editor) BufferRefreshEx(recur, scroll bool) {
 	}
 }
 
+// Scrolls horizontally by n columns, only possible when softwrap is disabled
+func (e *Editor) HScroll(n int) {
+	if e.sfr.Fr.HScroll(n) {
+		e.refreshIntl(true)
+		e.BufferRefreshEx(false, false)
+	}
+}
+
 func (e *Editor) FixTop() {
 	if e.otherSel[OS_TOP].E > e.bodybuf.Size() {
 		e.otherSel[OS_TOP].E = e.bodybuf.Size()
@@ -516,6 +609,9 @@ func (ed *Editor) recenterIntl() bool {
 }
 
 func (ed *Editor) Warp() {
+	if col := ed.Column(); col != nil {
+		col.stackShow(ed)
+	}
 	if !HasFocus {
 		return
 	}
@@ -612,6 +708,8 @@ func (ed *Editor) ExitSpecial(savedTag string, eventChan chan string) {
 		}
 		ed.eventChan = eventChan
 		ed.eventChanSpecial = false
+		ed.specialTag = ""
+		ed.clearHighlight()
 		if !ed.closed {
 			ed.tagbuf.Replace([]rune(savedTag), &util.Sel{ed.tagbuf.EditableStart, ed.tagbuf.Size()}, true, nil, 0)
 			ed.TagRefresh()
@@ -625,6 +723,7 @@ func (ed *Editor) PropTrigger() {
 	if err == nil {
 		ed.sfr.Fr.TabWidth = tabWidth
 	}
+	ed.framePropTrigger()
 	oldFont := ed.sfr.Fr.Font
 	if ed.bodybuf.Props["font"] == "alt" {
 		ed.sfr.Fr.Font = config.AltFont
@@ -640,6 +739,24 @@ func (ed *Editor) PropTrigger() {
 	ed.BufferRefresh()
 }
 
+func (ed *Editor) framePropTrigger() {
+	if ed.bodybuf.Props["wrap"] == "off" {
+		ed.sfr.Fr.Hackflags = textframe.HF_TRUNCATE
+	} else {
+		ed.sfr.Fr.Hackflags = textframe.HF_MARKSOFTWRAP | textframe.HF_AUTOINDENT_SOFTWRAP
+		ed.sfr.Fr.Offset = 0
+	}
+	switch ed.bodybuf.Props["linenumbers"] {
+	case "on":
+		ed.sfr.Fr.Gutter = textframe.GUTTER_ABSOLUTE
+	case "relative":
+		ed.sfr.Fr.Gutter = textframe.GUTTER_RELATIVE
+	default:
+		ed.sfr.Fr.Gutter = textframe.GUTTER_NONE
+	}
+	ed.sfr.Fr.Ruler, _ = strconv.Atoi(ed.bodybuf.Props["ruler"])
+}
+
 func (ed *Editor) Dump(buffers map[string]int, h int) DumpEditor {
 	fontName := ""
 	switch ed.sfr.Fr.Font {
@@ -657,6 +774,44 @@ func (ed *Editor) Dump(buffers map[string]int, h int) DumpEditor {
 		fontName,
 		string(ed.tagbuf.SelectionRunes(util.Sel{ed.tagbuf.EditableStart, ed.tagbuf.Size()})),
 		ed.sfr.Fr.Sel.S,
+		&util.Sel{ed.sfr.Fr.Sel.S, ed.sfr.Fr.Sel.E},
+		append([]util.Sel{}, ed.otherSel...),
+		append([]util.Sel{}, ed.jumps...),
+		ed.restoredJump,
+	}
+}
+
+func (ed *Editor) restoreDumpSels(de DumpEditor) {
+	if de.Sel != nil {
+		ed.sfr.Fr.Sel = *de.Sel
+	} else if de.SelS != 0 {
+		ed.sfr.Fr.Sel.S = de.SelS
+		ed.sfr.Fr.Sel.E = de.SelS
+	}
+	ed.bodybuf.FixSel(&ed.sfr.Fr.Sel)
+
+	if len(de.OtherSel) == NUM_OTHER_SEL {
+		copy(ed.otherSel, de.OtherSel)
+		for i := range ed.otherSel {
+			if ed.otherSel[i].S < 0 && ed.otherSel[i].E < 0 {
+				continue
+			}
+			ed.bodybuf.FixSel(&ed.otherSel[i])
+		}
+		ed.FixTop()
+	}
+
+	if len(de.Jumps) == NUM_JUMPS {
+		copy(ed.jumps, de.Jumps)
+		for i := range ed.jumps {
+			if ed.jumps[i].S < 0 {
+				continue
+			}
+			ed.bodybuf.FixSel(&ed.jumps[i])
+		}
+		if de.RestoredJump >= 0 && de.RestoredJump < NUM_JUMPS {
+			ed.restoredJump = de.RestoredJump
+		}
 	}
 }
 
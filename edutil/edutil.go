@@ -1,6 +1,8 @@
 package edutil
 
 import (
+	"strconv"
+
 	"github.com/aarzilli/yacco/buf"
 	"github.com/aarzilli/yacco/textframe"
 	"github.com/aarzilli/yacco/util"
@@ -59,6 +61,7 @@ func Scrollfn(buf *buf.Buffer, top *util.Sel, sfr *textframe.ScrollFrame, sd, sl
 		top.E = sfr.Fr.Top
 	}
 
+	UpdateGutter(buf, top, sfr)
 	DoHighlightingConsistency(buf, top, sfr)
 	sfr.Set(top.E, sz)
 	sfr.Redraw(true, nil)
@@ -70,6 +73,20 @@ func MakeScrollfn(buf *buf.Buffer, top *util.Sel, sfr *textframe.ScrollFrame) fu
 	}
 }
 
+// Updates the line numbers displayed in the gutter of sfr, must be called before inserting text if the number of lines of buf changed
+func UpdateGutter(buf *buf.Buffer, top *util.Sel, sfr *textframe.ScrollFrame) {
+	if sfr.Fr.Gutter == textframe.GUTTER_NONE {
+		return
+	}
+	sfr.Fr.FirstLine, _ = buf.GetLine(top.E)
+	n, _ := buf.GetLine(buf.Size())
+	sfr.Fr.GutterDigits = len(strconv.Itoa(n))
+}
+
 func DoHighlightingConsistency(buf *buf.Buffer, top *util.Sel, sfr *textframe.ScrollFrame) {
+	if sfr.Fr.Colorfn != nil {
+		sfr.Fr.RefreshColors(sfr.Fr.Colorfn(top.E, top.E+sfr.Fr.Size()))
+		return
+	}
 	sfr.Fr.RefreshColors(buf.Highlight(top.E, top.E+sfr.Fr.Size()))
 }
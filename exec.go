@@ -67,8 +67,22 @@ func init() {
 	cmds["Snarf"] = func(ec ExecContext, arg string) { CopyCmd(ec, arg, false) }
 	cmds["Copy"] = func(ec ExecContext, arg string) { CopyCmd(ec, arg, false) }
 	cmds["Sort"] = SortCmd
+	cmds["Stack"] = StackCmd
+	cmds["Focus"] = FocusCmd
+	cmds["Movecol"] = MovecolCmd
+	cmds["Grow"] = GrowCmd
+	cmds["Shrink"] = ShrinkCmd
+	cmds["Maximize"] = MaximizeCmd
+	cmds["Equalize"] = EqualizeCmd
 	cmds["Undo"] = UndoCmd
 	cmds["Zerox"] = ZeroxCmd
+	cmds["Split"] = SplitCmd
+	cmds["Lockscroll"] = LockscrollCmd
+	cmds["Diff"] = DiffCmd
+	cmds["Diff!Next"] = func(ec ExecContext, arg string) { DiffNextCmd(ec, arg, +1) }
+	cmds["Diff!Prev"] = func(ec ExecContext, arg string) { DiffNextCmd(ec, arg, -1) }
+	cmds["Diff!Push"] = func(ec ExecContext, arg string) { DiffPushCmd(ec, arg, false) }
+	cmds["Diff!Pull"] = func(ec ExecContext, arg string) { DiffPushCmd(ec, arg, true) }
 	cmds["|"] = PipeCmd
 	cmds["<"] = PipeInCmd
 	cmds[">"] = PipeOutCmd
@@ -79,23 +93,41 @@ func init() {
 	cmds["Look!Again"] = LookAgainCmd
 	cmds["Look!Quit"] = func(ec ExecContext, arg string) { SpecialSendCmd(ec, "!Quit") }
 	cmds["Look!Prev"] = func(ec ExecContext, arg string) { SpecialSendCmd(ec, "!Prev") }
+	for _, name := range []string{"Look!Replace", "Look!ReplaceAll", "Look!Skip", "Look!Case", "Look!Regexp"} {
+		name := name
+		cmds[name] = func(ec ExecContext, arg string) { SpecialSendCmd(ec, name) }
+	}
 	/*cmds["Paste!Primary"] = func(ec ExecContext, arg string) { PasteCmd(ec, arg, true) }
 	cmds["Paste!Indent"] = PasteIndentCmd*/
 	cmds["Jump"] = JumpCmd
+	cmds["Back"] = BackCmd
+	cmds["Forward"] = ForwardCmd
 	cmds["Getall"] = GetallCmd
 	cmds["Rename"] = RenameCmd
 	cmds["Rehash"] = RehashCmd
 	cmds["Do"] = DoCmd
 	cmds["Load"] = LoadCmd
+	cmds["Layout"] = LayoutCmd
 	cmds["Builtin"] = BuiltinCmd
 	cmds["Debug"] = DebugCmd
 	cmds["Help"] = HelpCmd
 	cmds["Theme"] = ThemeCmd
 	cmds["Direxec"] = DirexecCmd
 	cmds["Mark"] = MarkCmd
+	cmds["Fold"] = FoldCmd
+	cmds["Outline"] = OutlineCmd
+	cmds["Unfold"] = UnfoldCmd
+	cmds["Marks"] = MarksCmd
 	cmds["Savepos"] = SaveposCmd
 	cmds["Tooltip"] = TooltipCmd
 	cmds["NextError"] = NextErrorCmd
+	cmds["History"] = HistoryCmd
+	cmds["Recover"] = RecoverCmd
+	cmds["Clipboard"] = ClipboardCmd
+	cmds["Reflow"] = ReflowCmd
+	cmds["Template"] = TemplateCmd
+	cmds["Workspace"] = WorkspaceCmd
+	cmds["Workspaces"] = WorkspacesCmd
 }
 
 func HelpCmd(ec ExecContext, arg string) {
@@ -154,6 +186,7 @@ $			the point after the last character
 #wn		empty string after the n-th word
 #?n			don't use this
 .			whatever is currently selected
+'name			the bookmark called name, see Mark
 /regexp/
 ?regexp?	forward or backward lookup for regexp match
 /@regexp/
@@ -194,7 +227,14 @@ Exit
 Undo
 Redo
 Edit <…>		Runs sed-like editing commands, see Help Edit
-Look [<text>]	Search <text> or starts interactive search
+Look [<text>]	Search <text> or starts interactive search, in interactive search text typed after a tab is the replacement
+Look!Replace, Look!ReplaceAll, Look!Skip	Replaces the current match (or all matches) of interactive search, or moves to the next one
+Look!Case, Look!Regexp	Toggles case sensitive search and regular expression search in interactive search
+Reflow [<width>]	Rewraps the selected paragraphs (or the one containing the cursor) to <width> columns, preserving indentation and comment prefixes
+Template <prefix>	Inserts the template starting with <prefix>, replacing the selection (available to snippets as $SELECTION)
+Fold [all]		Hides the selection, or the block started by the current line, or all blocks started by lines that aren't indented
+Unfold [all]		Shows again the text hidden by the fold at the cursor (or by all folds)
+Outline		Lists functions, methods and types of the current file in +Outline, the list is updated when the file is saved
 
 == Frames and Columns ==
 New
@@ -203,7 +243,18 @@ Delete			Like Del but can not be blocked by an attached process
 Newcol
 Delcol
 Zerox			Duplicates current frame
+Split [lock]		Duplicates current frame in the adjacent column, with lock the two frames scroll together
+Lockscroll		Toggles scrolling together with the frame next to this one in the adjacent column
+Diff [HEAD|<file>|<a> <b>]	Compares current buffer to its file (or to git HEAD, or to <file>), or <a> to <b>, side by side
+Diff!Next, Diff!Prev	Moves to the next or previous change of a Diff
+Diff!Push, Diff!Pull	Copies the change under the cursor to the other side of a Diff, or from the other side
 Sort			Sort frames in current column alphabetically
+Focus left|right|up|down	Moves the focus to the adjacent frame
+Movecol next|prev	Moves current frame to the next (previous) column
+Grow [<n>], Shrink [<n>]	Makes current frame <n> lines taller (shorter)
+Maximize		Shrinks all other frames of the column to their tags, executed again restores their sizes
+Equalize [cols]		Gives the same height to all frames of the column (or the same width to all columns)
+Stack [next|prev]	Toggles showing only one frame of the column, with the others listed in the column tag, or shows the next (previous) frame
 Rename <name>
 LookFile		Opens special frame to search and open files interactively
 
@@ -211,7 +262,8 @@ LookFile		Opens special frame to search and open files interactively
 Cut			Cuts current selection, or between mark and cursor if the selection is empty
 Copy			Copies current selection, or between mark and cursor if the selection is empty
 Snarf			Same as Copy
-Paste [primary|indent]
+Paste [primary|indent|cycle|<n>]	Pastes the clipboard, cycle replaces the text just pasted with the previous clipboard entry, <n> pastes the n-th entry of the clipboard history
+Clipboard		Lists the clipboard history
 Savepos			Copies current position of the cursor to clipboard
 
 All of Cut, Copy and Paste will reset the mark
@@ -219,6 +271,10 @@ All of Cut, Copy and Paste will reset the mark
 == Session ==
 Dump [<name>]		Starts saving session to <name>
 Load [<name>]		Loads session from <name> (omit for a list of sessions)
+Layout save|restore <name>	Saves the arrangement of columns and frames as <name>, or restores it opening missing files (omit arguments for a list of layouts)
+Workspace [<name>]	Saves the current session and switches to workspace <name> (defaults to a name derived from the git root of the current directory)
+Workspaces		Lists saved workspaces
+Recover [diff|discard] [<path>]	Lists files with unsaved changes recovered from a crashed session (with a path restores, diffs or discards its recovered contents)
 
 == Jobs ==
 | <ext. cmd.>		Runs selection through <ext. cmd.> replaces with output
@@ -228,6 +284,7 @@ Jobs			Lists currently running jobs
 Kill [<jobnum>]		Kill all jobs (or the one specified)
 Setenv <var> <val>
 Cd <dir>
+History [<regexp>]	Lists recently executed commands (middle click one to execute it again in its directory)
 
 == External Utilities ==
 E <file>		Edits file
@@ -251,7 +308,11 @@ Send			Inserts clipboard or last selection in buffer
 Builtin <…>		Runs command as builtin (skip attached processes)
 Debug <…>		Run without arguments for informations
 Mark			Sets the mark
+Mark <name>		Sets a bookmark, Mark -d <name> deletes it
 Jump			Swap cursor and mark
+Jump <name>		Moves to a bookmark
+Marks			Lists bookmarks
+Back, Forward		Moves to the position before the last jump to a file (or the one after it) in the jump history
 Direxec			Executes the specified command on the currently selected directory entry.
 NextError		Tries to load the file specified in the next line of the last editor where a load operation was executed
 `)
@@ -307,6 +368,8 @@ func execGuard() {
 
 func Exec(ec ExecContext, cmd string) {
 	defer execGuard()
+	watchExec(ec, strings.TrimSpace(cmd))
+	jsonLogExec(ec, strings.TrimSpace(cmd))
 	execNoDefer(ec, cmd)
 }
 
@@ -327,6 +390,12 @@ func ExtExec(ec ExecContext, cmd string, dolog bool) {
 	if ec.dir != "" {
 		wd = ec.dir
 	}
+	if ec.buf != nil && ec.buf.Name == "+History" {
+		// lines of +History are executed in the directory they were originally executed in
+		if hcmd, hdir, ok := historyLineSplit(cmd); ok {
+			cmd, wd = hcmd, hdir
+		}
+	}
 	if dolog {
 		LogExec(cmd, wd)
 	}
@@ -379,7 +448,7 @@ func CopyCmd(ec ExecContext, arg string, del bool) {
 			ec.br()
 		}
 	}
-	clipboard.Set(s)
+	clipboardSet(s)
 }
 
 func DelCmd(ec ExecContext, arg string, confirmed bool) {
@@ -558,6 +627,10 @@ func ExitCmd(ec ExecContext, arg string) {
 	}
 
 	if (n == 0) || exitConfirmed {
+		if len(bookmarks) > 0 {
+			saveBookmarks()
+		}
+		recoverCleanup()
 		FsQuit()
 	} else {
 		exitConfirmed = true
@@ -606,7 +679,7 @@ func LookCmd(ec ExecContext, arg string) {
 	ec.ed.confirmDel = false
 	ec.ed.confirmSave = false
 	if arg != "" {
-		lookfwd(ec.ed, []rune(arg), true, Wnd.Prop["lookexact"] == "yes")
+		lookfwd(ec.ed, []rune(arg), true, lookOpts{exact: Wnd.Prop["lookexact"] == "yes"})
 	} else {
 		ec.fr = &ec.ed.sfr.Fr
 		go lookproc(ec)
@@ -621,7 +694,7 @@ func LookAgainCmd(ec ExecContext, arg string) {
 	if ec.ed.eventChanSpecial && ec.ed.eventChan != nil {
 		SpecialSendCmd(ec, "Look!Again")
 	} else {
-		lookfwd(ec.ed, lastNeedle, true, Wnd.Prop["lookexact"] == "yes")
+		lookfwd(ec.ed, lastNeedle, true, lookOpts{exact: Wnd.Prop["lookexact"] == "yes"})
 	}
 }
 
@@ -654,6 +727,7 @@ func GetCmd(ec ExecContext, arg string) {
 		ec.ed.bodybuf.Reload(true)
 		ec.ed.FixTop()
 	}
+	jsonLog(&jsonLogEntry{Event: string(LOP_GET), Buffer: jsonLogBufferOf(ec.ed.edid, ec.ed.bodybuf)})
 	if !ec.norefresh {
 		ec.ed.TagRefresh()
 		ec.ed.BufferRefresh()
@@ -681,6 +755,16 @@ func NewcolCmd(ec ExecContext, arg string) {
 
 func PasteCmd(ec ExecContext, arg string) {
 	exitConfirmed = false
+
+	// Paste <n> pastes the n-th entry of the clipboard history in the active editor
+	n := -1
+	if v := strings.Fields(arg); len(v) > 0 {
+		if i, err := strconv.Atoi(v[0]); err == nil {
+			n = i
+			col2active(&ec)
+		}
+	}
+
 	if ec.ed != nil {
 		ec.ed.confirmDel = false
 		ec.ed.confirmSave = false
@@ -688,11 +772,29 @@ func PasteCmd(ec ExecContext, arg string) {
 	if (ec.buf == nil) || (ec.fr == nil) || (ec.br == nil) {
 		return
 	}
+
+	if n >= 0 {
+		if ec.buf.Name == "+Clipboard" {
+			return
+		}
+		if n < 1 || n > len(clipboard.History()) {
+			Warn(fmt.Sprintf("Paste: no clipboard entry %d", n))
+			return
+		}
+		pasteHistory(ec, n-1)
+		return
+	}
+
 	var cb string
+	start := ec.fr.Sel.S
 
 	switch arg {
 	case "Indent", "indent":
 		PasteIndentCmd(ec, arg)
+		pasteDone(ec, start, -1)
+		return
+	case "Cycle", "cycle":
+		pasteCycle(ec)
 		return
 	case "Primary", "primary":
 		cb = clipboard.GetPrimary()
@@ -701,6 +803,7 @@ func PasteCmd(ec ExecContext, arg string) {
 	}
 
 	ec.buf.Replace([]rune(cb), &ec.fr.Sel, true, ec.eventChan, util.EO_MOUSE)
+	pasteDone(ec, start, -1)
 	if !ec.norefresh {
 		ec.br()
 	}
@@ -797,10 +900,22 @@ func PutCmd(ec ExecContext, arg string) {
 			return
 		}
 	}
+	if !runFmtHooks(ec.ed, func() { putEditor(ec) }) {
+		putEditor(ec)
+	}
+}
+
+// Writes the buffer of ec.ed to disk
+func putEditor(ec ExecContext) {
 	Log(ec.ed.edid, LOP_PUT, ec.ed.bodybuf)
 	err := ec.ed.bodybuf.Put()
 	if err != nil {
 		Warn(fmt.Sprintf("Put: Couldn't save %s: %s", ec.ed.bodybuf.ShortName(), err.Error()))
+	} else {
+		jsonLog(&jsonLogEntry{Event: string(LOP_PUT), Buffer: jsonLogBufferOf(ec.ed.edid, ec.ed.bodybuf)})
+		runLintHooks(ec.ed)
+		saveBookmarksOf(ec.ed.bodybuf.Path())
+		refreshOutlines(ec.ed)
 	}
 	if !ec.norefresh {
 		ec.ed.BufferRefresh()
@@ -815,19 +930,37 @@ func PutCmd(ec ExecContext, arg string) {
 
 func PutallCmd(ec ExecContext, arg string) {
 	exitConfirmed = false
+	put := func(ed *Editor) error {
+		err := ed.bodybuf.Put()
+		if err == nil {
+			runLintHooks(ed)
+			saveBookmarksOf(ed.bodybuf.Path())
+			refreshOutlines(ed)
+		}
+		if !ec.norefresh {
+			ed.BufferRefresh()
+		}
+		return err
+	}
 	t := "Putall: Saving the following files failed:\n"
 	nerr := 0
+	formatting := map[*buf.Buffer]bool{} // buffers already handed to their formatters, they are still modified
 	for _, col := range Wnd.cols.cols {
 		for _, ed := range col.editors {
-			if !fakebuf(ed.bodybuf.Name) && ed.bodybuf.Modified {
-				err := ed.bodybuf.Put()
-				if err != nil {
+			if !fakebuf(ed.bodybuf.Name) && ed.bodybuf.Modified && !formatting[ed.bodybuf] {
+				ed := ed
+				if runFmtHooks(ed, func() {
+					if err := put(ed); err != nil {
+						Warn(fmt.Sprintf("Putall: Couldn't save %s: %s", ed.bodybuf.ShortName(), err.Error()))
+					}
+				}) {
+					formatting[ed.bodybuf] = true
+					continue
+				}
+				if err := put(ed); err != nil {
 					t += ed.bodybuf.ShortName() + ": " + err.Error() + "\n"
 					nerr++
 				}
-				if !ec.norefresh {
-					ed.BufferRefresh()
-				}
 			}
 		}
 	}
@@ -908,6 +1041,42 @@ func SortCmd(ec ExecContext, arg string) {
 	Wnd.FlushImage(ec.col.r)
 }
 
+// Toggles the stacked mode of the column, or shows the next (previous) editor of a stacked column
+func StackCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	col := ec.col
+	if col == nil && ec.ed != nil {
+		col = ec.ed.Column()
+	}
+	if col == nil && activeEditor != nil {
+		col = activeEditor.Column()
+	}
+	if col == nil {
+		return
+	}
+
+	switch arg = strings.TrimSpace(arg); arg {
+	case "":
+		col.SetStacked(!col.stacked)
+	case "next", "prev":
+		if !col.stacked || len(col.editors) == 0 {
+			return
+		}
+		i := col.IndexOf(col.stackCurrent())
+		if arg == "next" {
+			i = (i + 1) % len(col.editors)
+		} else {
+			i = (i + len(col.editors) - 1) % len(col.editors)
+		}
+		ed := col.editors[i]
+		col.stackShow(ed)
+		setActive(ed, nil)
+		ed.Warp()
+	default:
+		Warn("Stack: unknown argument " + arg)
+	}
+}
+
 func UndoCmd(ec ExecContext, arg string) {
 	exitConfirmed = false
 	if (ec.ed == nil) || (ec.buf == nil) {
@@ -939,6 +1108,74 @@ func ZeroxCmd(ec ExecContext, arg string) {
 	HeuristicPlaceEditor(ned, true)
 }
 
+const defaultReflowWidth = 75
+
+func ReflowCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	col2active(&ec)
+	if ec.ed == nil {
+		return
+	}
+	ec.ed.confirmDel = false
+	ec.ed.confirmSave = false
+
+	b := ec.ed.bodybuf
+
+	width := defaultReflowWidth
+	if n, err := strconv.Atoi(b.Props["ruler"]); err == nil && n > 0 {
+		width = n
+	}
+	if arg = strings.TrimSpace(arg); arg != "" {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			Warn("Reflow: wrong width " + arg)
+			return
+		}
+		width = n
+	}
+
+	blank := func(s, e int) bool {
+		_, rest := util.CommentPrefix(string(b.SelectionRunes(util.Sel{s, e})))
+		return strings.TrimSpace(rest) == ""
+	}
+
+	sel := ec.fr.Sel
+	sel.S = b.Tonl(sel.S-1, -1)
+	if sel.S == sel.E || b.At(sel.E-1) != '\n' {
+		sel.E = b.Tonl(sel.E, +1)
+	}
+	if ec.fr.Sel.S == ec.fr.Sel.E && !blank(sel.S, sel.E) {
+		// no selection, reflow the paragraph containing the cursor
+		for sel.S > 0 {
+			prev := b.Tonl(sel.S-2, -1)
+			if blank(prev, sel.S) {
+				break
+			}
+			sel.S = prev
+		}
+		for sel.E < b.Size() {
+			next := b.Tonl(sel.E, +1)
+			if blank(sel.E, next) {
+				break
+			}
+			sel.E = next
+		}
+	}
+
+	txt := string(b.SelectionRunes(sel))
+	out := []rune(util.Reflow(txt, width))
+	if string(out) == txt {
+		return
+	}
+
+	ec.fr.Sel = sel
+	b.Replace(out, &ec.fr.Sel, true, ec.eventChan, util.EO_MOUSE)
+	ec.fr.Sel = util.Sel{sel.S, sel.S + len(out)}
+	if ec.br != nil && !ec.norefresh {
+		ec.br()
+	}
+}
+
 func PipeCmd(ec ExecContext, arg string) {
 	exitConfirmed = false
 	col2active(&ec)
@@ -1071,6 +1308,18 @@ func JumpCmd(ec ExecContext, arg string) {
 	}
 	ec.ed.confirmDel = false
 	ec.ed.confirmSave = false
+	if name := strings.TrimSpace(arg); name != "" {
+		jp := findBookmark(ec.ed, name)
+		if jp == nil {
+			Warn("Jump: no bookmark named " + name)
+			return
+		}
+		from := currentJumpPos(ec.ed)
+		if gotoJumpPos(jp) {
+			recordJump(from, activeEditor)
+		}
+		return
+	}
 	if ec.ed.otherSel[OS_MARK].S >= 0 && ec.ed.otherSel[OS_MARK].E >= 0 {
 		s := ec.ed.sfr.Fr.Sel
 		ec.ed.sfr.Fr.Sel = ec.ed.otherSel[OS_MARK]
@@ -1311,7 +1560,27 @@ func MarkCmd(ec ExecContext, arg string) {
 	}
 	ec.ed.confirmDel = false
 	ec.ed.confirmSave = false
-	ec.ed.otherSel[OS_MARK] = ec.ed.sfr.Fr.Sel
+
+	v := strings.Fields(arg)
+	switch {
+	case len(v) == 0:
+		ec.ed.otherSel[OS_MARK] = ec.ed.sfr.Fr.Sel
+	case len(v) == 1 && validBookmarkName(v[0]):
+		if fakebuf(ec.ed.bodybuf.Name) {
+			Warn("Mark: can not set bookmarks in " + ec.ed.bodybuf.Name)
+			return
+		}
+		setBookmark(v[0], currentJumpPos(ec.ed))
+		saveBookmarks()
+	case len(v) == 2 && v[0] == "-d":
+		if !delBookmark(ec.ed.bodybuf.Path(), v[1]) {
+			Warn("Mark: no bookmark named " + v[1])
+			return
+		}
+		saveBookmarks()
+	default:
+		Warn("Mark: wrong arguments, use Mark [<name>] or Mark -d <name>, names can only contain letters, digits and underscores")
+	}
 }
 
 func SaveposCmd(ec ExecContext, arg string) {
@@ -1326,17 +1595,17 @@ func SaveposCmd(ec ExecContext, arg string) {
 	p := b.Path()
 	if arg == "char" {
 		if s.S == s.E {
-			clipboard.Set(fmt.Sprintf("%s:#%d", p, s.S))
+			clipboardSet(fmt.Sprintf("%s:#%d", p, s.S))
 		} else {
-			clipboard.Set(fmt.Sprintf("%s:#%d,#%d", p, s.S, s.E))
+			clipboardSet(fmt.Sprintf("%s:#%d,#%d", p, s.S, s.E))
 		}
 	} else {
 		sln, _ := b.GetLine(s.S)
 		if s.S == s.E {
-			clipboard.Set(fmt.Sprintf("%s:%d", p, sln))
+			clipboardSet(fmt.Sprintf("%s:%d", p, sln))
 		} else {
 			eln, _ := b.GetLine(s.E)
-			clipboard.Set(fmt.Sprintf("%s:%d,%d", p, sln, eln))
+			clipboardSet(fmt.Sprintf("%s:%d,%d", p, sln, eln))
 		}
 	}
 }
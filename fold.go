@@ -0,0 +1,208 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+Folded regions of a buffer are hidden by the editor and drawn as a single ellipsis (see textframe.Frame.Folds).
+Folds belong to the editor and are registered as selections of its buffer so that they follow edits, a fold is opened when the cursor moves inside it.
+*/
+
+// Updates the folds of the frame with the folds of the editor, returns true if they changed
+func (ed *Editor) syncFolds() bool {
+	if len(ed.folds) == 0 && len(ed.sfr.Fr.Folds) == 0 {
+		return false
+	}
+
+	sel := ed.sfr.Fr.Sel
+	inside := func(p int, fold *util.Sel) bool {
+		return p > fold.S && p < fold.E
+	}
+
+	ed.filterFolds(func(fold *util.Sel) bool {
+		return fold.S >= fold.E || inside(sel.S, fold) || inside(sel.E, fold)
+	})
+	sort.Sort(foldsByStart(ed.folds))
+
+	r := make([]util.Sel, 0, len(ed.folds))
+	for _, fold := range ed.folds {
+		r = append(r, *fold)
+	}
+	if util.SelsEqual(r, ed.sfr.Fr.Folds) {
+		return false
+	}
+	ed.sfr.Fr.Folds = r
+	return true
+}
+
+type foldsByStart []*util.Sel
+
+func (v foldsByStart) Len() int           { return len(v) }
+func (v foldsByStart) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v foldsByStart) Less(i, j int) bool { return v[i].S < v[j].S }
+
+// Removes the folds for which remove returns true, returns true if any fold was removed
+func (ed *Editor) filterFolds(remove func(fold *util.Sel) bool) bool {
+	removed := false
+	folds := ed.folds[:0]
+	for _, fold := range ed.folds {
+		if remove(fold) {
+			ed.bodybuf.RmSel(fold)
+			removed = true
+			continue
+		}
+		folds = append(folds, fold)
+	}
+	ed.folds = folds
+	return removed
+}
+
+// Folds sel, folds overlapping sel are removed
+func (ed *Editor) addFold(sel util.Sel) {
+	ed.filterFolds(func(fold *util.Sel) bool {
+		return fold.S < sel.E && fold.E > sel.S
+	})
+	fold := &util.Sel{sel.S, sel.E}
+	ed.bodybuf.AddSel(fold)
+	ed.folds = append(ed.folds, fold)
+}
+
+// Removes the folds overlapping sel, including the folds starting or ending at its extremes
+func (ed *Editor) removeFolds(sel util.Sel) bool {
+	return ed.filterFolds(func(fold *util.Sel) bool {
+		return fold.S <= sel.E && fold.E >= sel.S
+	})
+}
+
+// Returns the line containing p, the end of the line includes the newline
+func lineAt(b *buf.Buffer, p int) (int, int) {
+	return b.Tonl(p-1, -1), b.Tonl(p, +1)
+}
+
+// Returns the block started by the line containing p: the text between the last parenthesis of the line and its matching parenthesis, if they are on different lines, or the lines after it that are more indented
+func foldableBlock(b *buf.Buffer, p int, tabWidth int) (util.Sel, bool) {
+	ls, le := lineAt(b, p)
+
+	for i := le - 1; i >= ls; i-- {
+		if !strings.ContainsRune(buf.OPEN_PARENTHESIS, b.At(i)) {
+			continue
+		}
+		if m := b.Topmatch(i, +1); m >= le {
+			return util.Sel{i + 1, m}, true
+		}
+	}
+
+	lineEnd := func(le int) int {
+		if le > 0 && b.At(le-1) == '\n' {
+			return le - 1
+		}
+		return le
+	}
+
+	ind, blank := indentation(b, ls, tabWidth)
+	if blank {
+		return util.Sel{}, false
+	}
+	end := -1
+	for s := le; s < b.Size(); {
+		_, e := lineAt(b, s)
+		if e <= s {
+			break
+		}
+		lind, lblank := indentation(b, s, tabWidth)
+		if !lblank {
+			if lind <= ind {
+				break
+			}
+			end = lineEnd(e)
+		}
+		s = e
+	}
+	if end < 0 {
+		return util.Sel{}, false
+	}
+	return util.Sel{lineEnd(le), end}, true
+}
+
+// Returns the indentation of the line starting at ls and whether the line is blank
+func indentation(b *buf.Buffer, ls int, tabWidth int) (int, bool) {
+	n := 0
+	for i := ls; i < b.Size(); i++ {
+		switch b.At(i) {
+		case ' ':
+			n++
+		case '\t':
+			n += tabWidth - n%tabWidth
+		case '\n':
+			return n, true
+		default:
+			return n, false
+		}
+	}
+	return n, true
+}
+
+// Folds all blocks started by lines that aren't indented
+func (ed *Editor) foldAll() {
+	b := ed.bodybuf
+	for s := 0; s < b.Size(); {
+		_, e := lineAt(b, s)
+		if e <= s {
+			break
+		}
+		if ind, blank := indentation(b, s, ed.sfr.Fr.TabWidth); ind == 0 && !blank {
+			if fold, ok := foldableBlock(b, s, ed.sfr.Fr.TabWidth); ok {
+				ed.addFold(fold)
+				_, e = lineAt(b, fold.E)
+			}
+		}
+		s = e
+	}
+}
+
+// Folds the selection or, if it is empty, the block started by the line containing the cursor
+func FoldCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	if ec.ed == nil {
+		return
+	}
+	ed := ec.ed
+
+	switch {
+	case strings.TrimSpace(arg) == "all":
+		ed.foldAll()
+	case ed.sfr.Fr.Sel.S != ed.sfr.Fr.Sel.E:
+		ed.addFold(ed.sfr.Fr.Sel)
+		ed.sfr.Fr.Sel.E = ed.sfr.Fr.Sel.S
+	default:
+		fold, ok := foldableBlock(ed.bodybuf, ed.sfr.Fr.Sel.S, ed.sfr.Fr.TabWidth)
+		if !ok {
+			Warn("Fold: nothing to fold")
+			return
+		}
+		ed.addFold(fold)
+	}
+	ed.BufferRefresh()
+}
+
+// Opens the folds at the cursor (or all the folds)
+func UnfoldCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	if ec.ed == nil {
+		return
+	}
+	ed := ec.ed
+
+	if strings.TrimSpace(arg) == "all" {
+		ed.filterFolds(func(*util.Sel) bool { return true })
+	} else if !ed.removeFolds(ed.sfr.Fr.Sel) {
+		ls, le := lineAt(ed.bodybuf, ed.sfr.Fr.Sel.S)
+		ed.removeFolds(util.Sel{ls, le})
+	}
+	ed.BufferRefresh()
+}
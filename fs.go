@@ -97,6 +97,13 @@ func FsInit() {
 	log.Add(p9root, "log", user, nil, 0666, log)
 	last := &ReadOnlyP9{srv.File{}, lastFileFn}
 	last.Add(p9root, "last", user, nil, 0444, last)
+	watch := &ReadOpenFidP9{ReadOpenP9{srv.File{},
+		func(conn string) error { return openWatchFn(watchGlobal, conn) },
+		func(conn string) ([]byte, syscall.Errno) { return readWatchFn(watchGlobal, conn) },
+		func(conn string) error { return clunkWatchFn(watchGlobal, conn) }}}
+	watch.Add(p9root, "watch", user, nil, 0444, watch)
+	jsonlog := &ReadOpenFidP9{ReadOpenP9{srv.File{}, openJsonLogFn, readJsonLogFn, clunkJsonLogFn}}
+	jsonlog.Add(p9root, "jsonlog", user, nil, 0444, jsonlog)
 
 	p9Srv = &CustomP9Server{srv.NewFileSrv(p9root)}
 	p9Srv.Dotu = true
@@ -126,7 +133,6 @@ func FsQuit() {
 	QuitMu.Lock()
 	Quitting = true
 	QuitMu.Unlock()
-	HistoryWrite()
 	for i := range jobs {
 		jobKill(i)
 	}
@@ -223,6 +229,11 @@ func FsAddEditor(n int) {
 	prop.Add(bufdir, "prop", user, nil, 0660, prop)
 	jumps := &ReadOnlyP9{srv.File{}, bwr(jumpFileFn)}
 	jumps.Add(bufdir, "jumps", user, nil, 0440, jumps)
+	watch := &ReadOpenFidP9{ReadOpenP9{srv.File{},
+		func(conn string) error { return openWatchFn(n, conn) },
+		func(conn string) ([]byte, syscall.Errno) { return readWatchFn(n, conn) },
+		func(conn string) error { return clunkWatchFn(n, conn) }}}
+	watch.Add(bufdir, "watch", user, nil, 0440, watch)
 }
 
 func FsRemoveEditor(n int) {
@@ -231,6 +242,7 @@ func FsRemoveEditor(n int) {
 	if bufdir != nil {
 		bufdir.Remove()
 	}
+	watchRemove(n)
 }
 
 type CustomP9Server struct {
@@ -407,6 +419,28 @@ func (fh *ReadOpenP9) Clunk(fid *srv.FFid) error {
 	return fh.clunkFn(fidToId(fid))
 }
 
+// Like ReadOpenP9 but every open of the file is a separate reader, even when a connection opens the same file more than once
+type ReadOpenFidP9 struct {
+	ReadOpenP9
+}
+
+func fidToOpenId(fid *srv.FFid) string {
+	return fmt.Sprintf("%p", fid)
+}
+
+func (fh *ReadOpenFidP9) Open(fid *srv.FFid, mode uint8) error {
+	return fh.openFn(fidToOpenId(fid))
+}
+
+func (fh *ReadOpenFidP9) Read(fid *srv.FFid, buf []byte, offset uint64) (int, error) {
+	b, r := fh.readFn(fidToOpenId(fid))
+	return readhelp(buf, b, r)
+}
+
+func (fh *ReadOpenFidP9) Clunk(fid *srv.FFid) error {
+	return fh.clunkFn(fidToOpenId(fid))
+}
+
 func acmeCompatStart(cmdName string, cmdArgs []string) {
 	cmd := exec.Command(cmdName, cmdArgs...)
 	conn, err := net.Dial("tcp4", p9ListenAddr)
@@ -496,23 +530,7 @@ func readColumnsFn(off int64) ([]byte, syscall.Errno) {
 	}
 
 	var bw bytes.Buffer
-
-	fmt.Fprintf(&bw, "sz")
-
-	for i := range Wnd.cols.cols {
-		fmt.Fprintf(&bw, " %0.4f", Wnd.cols.cols[i].frac/10)
-	}
-
-	fmt.Fprintf(&bw, "\n")
-
-	for i := range Wnd.cols.cols {
-		fmt.Fprintf(&bw, "%d", i)
-		for j := range Wnd.cols.cols[i].editors {
-			fmt.Fprintf(&bw, " %d", Wnd.cols.cols[i].editors[j].edid)
-		}
-		fmt.Fprintf(&bw, "\n")
-	}
-
+	writeColumns(&bw, func(ed *Editor) string { return strconv.Itoa(ed.edid) })
 	return bw.Bytes(), 0
 }
 
@@ -651,7 +669,7 @@ func writeBodyFn(i int, data []byte, off int64) syscall.Errno {
 		sdata = ""
 	}
 	debugfsf("Write body <%s>\n", sdata)
-	sideChan <- ReplaceMsg(ec, nil, true, sdata, util.EO_BODYTAG, false, false)
+	sideChan <- ReplaceMsg(ec, nil, true, sdata, util.EO_BODYTAG, false, false, false)
 	return 0
 }
 
@@ -811,7 +829,7 @@ func writeDataFn(i int, data []byte, off int64) syscall.Errno {
 		sdata = ""
 	}
 	debugfsf("Write data <%s>\n", sdata)
-	f := ReplaceMsg(ec, &ec.ed.otherSel[OS_ADDR], false, sdata, util.EO_FILES, false, false)
+	f := ReplaceMsg(ec, &ec.ed.otherSel[OS_ADDR], false, sdata, util.EO_FILES, false, false, false)
 	sideChan <- func() {
 		matchS := ec.ed.otherSel[OS_ADDR].S == ec.ed.sfr.Fr.Sel.S
 		matchE := ec.ed.otherSel[OS_ADDR].E == ec.ed.sfr.Fr.Sel.E
@@ -0,0 +1,56 @@
+package headless
+
+import (
+	"image"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// Face is a monospaced font.Face that draws nothing, it can be used to lay out text when no fonts are configured.
+type Face struct {
+	Width, Ascent, Descent int
+	mask                   *image.Alpha
+}
+
+// NewFace returns a Face where every glyph is width pixels wide and lines are height pixels tall.
+func NewFace(width, height int) *Face {
+	ascent := height * 4 / 5
+	return &Face{
+		Width:   width,
+		Ascent:  ascent,
+		Descent: height - ascent,
+		mask:    image.NewAlpha(image.Rect(0, 0, width, height)),
+	}
+}
+
+func (f *Face) Close() error {
+	return nil
+}
+
+func (f *Face) Glyph(dot fixed.Point26_6, r rune) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	x, y := dot.X.Floor(), dot.Y.Floor()
+	dr = image.Rect(x, y-f.Ascent, x+f.Width, y+f.Descent)
+	return dr, f.mask, image.ZP, fixed.I(f.Width), true
+}
+
+func (f *Face) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	bounds = fixed.R(0, -f.Ascent, f.Width, f.Descent)
+	return bounds, fixed.I(f.Width), true
+}
+
+func (f *Face) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	return fixed.I(f.Width), true
+}
+
+func (f *Face) Kern(r0, r1 rune) fixed.Int26_6 {
+	return 0
+}
+
+func (f *Face) Metrics() font.Metrics {
+	return font.Metrics{
+		Height:  fixed.I(f.Ascent + f.Descent),
+		Ascent:  fixed.I(f.Ascent),
+		Descent: fixed.I(f.Descent),
+	}
+}
@@ -0,0 +1,109 @@
+// Package headless implements a shiny screen that doesn't display anything.
+// Windows created by it never generate events on their own, events can be injected with Send.
+package headless
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/exp/shiny/screen"
+	"golang.org/x/image/math/f64"
+)
+
+type Screen struct {
+}
+
+func NewScreen() *Screen {
+	return &Screen{}
+}
+
+func (s *Screen) NewBuffer(size image.Point) (screen.Buffer, error) {
+	return &buffer{image.NewRGBA(image.Rectangle{image.ZP, size})}, nil
+}
+
+func (s *Screen) NewTexture(size image.Point) (screen.Texture, error) {
+	return &texture{size}, nil
+}
+
+func (s *Screen) NewWindow(opts *screen.NewWindowOptions) (screen.Window, error) {
+	w := &Window{}
+	w.cond = sync.NewCond(&w.mu)
+	return w, nil
+}
+
+type buffer struct {
+	rgba *image.RGBA
+}
+
+func (b *buffer) Release()                {}
+func (b *buffer) Size() image.Point       { return b.rgba.Bounds().Size() }
+func (b *buffer) Bounds() image.Rectangle { return b.rgba.Bounds() }
+func (b *buffer) RGBA() *image.RGBA       { return b.rgba }
+
+type texture struct {
+	size image.Point
+}
+
+func (t *texture) Release()                                                     {}
+func (t *texture) Size() image.Point                                            { return t.size }
+func (t *texture) Bounds() image.Rectangle                                      { return image.Rectangle{image.ZP, t.size} }
+func (t *texture) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {}
+func (t *texture) Fill(dr image.Rectangle, src color.Color, op draw.Op)         {}
+
+type Window struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	events []interface{}
+}
+
+func (w *Window) Release() {}
+
+func (w *Window) Send(event interface{}) {
+	w.mu.Lock()
+	w.events = append(w.events, event)
+	w.mu.Unlock()
+	w.cond.Signal()
+}
+
+func (w *Window) SendFirst(event interface{}) {
+	w.mu.Lock()
+	w.events = append([]interface{}{event}, w.events...)
+	w.mu.Unlock()
+	w.cond.Signal()
+}
+
+func (w *Window) NextEvent() interface{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.events) == 0 {
+		w.cond.Wait()
+	}
+	e := w.events[0]
+	w.events = w.events[1:]
+	return e
+}
+
+func (w *Window) Upload(dp image.Point, src screen.Buffer, sr image.Rectangle) {}
+func (w *Window) Fill(dr image.Rectangle, src color.Color, op draw.Op)         {}
+
+func (w *Window) Draw(src2dst f64.Aff3, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (w *Window) DrawUniform(src2dst f64.Aff3, src color.Color, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (w *Window) Copy(dp image.Point, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (w *Window) Scale(dr image.Rectangle, src screen.Texture, sr image.Rectangle, op draw.Op, opts *screen.DrawOptions) {
+}
+
+func (w *Window) Publish() screen.PublishResult {
+	return screen.PublishResult{}
+}
+
+func (w *Window) SetTitle(string) error         { return nil }
+func (w *Window) SetCursor(screen.Cursor) error { return nil }
+func (w *Window) WarpMouse(p image.Point) error { return nil }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"image"
+	"time"
+	"unicode"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+An editor can highlight all visible matches of a needle: the needle of interactive Look or, if the hlword property of the window is "yes", the word under the cursor once the user stops typing.
+Highlights are recomputed by the main loop after every event, only for the visible part of the buffer.
+*/
+
+// time without typing after which the word under the cursor is highlighted
+const hlWordIdle = 500 * time.Millisecond
+
+// wakes up the main loop when the user stops typing
+var hlWordTimer *time.Timer
+
+// Sets the text highlighted in ed, word is true if needle is the word under the cursor
+func (ed *Editor) setHighlight(needle []rune, opts lookOpts, word bool) {
+	h := &ed.highlight
+	if word == h.word && opts == h.opts && runeEquals(needle, h.needle) {
+		return
+	}
+	h.needle = needle
+	h.opts = opts
+	h.matcher = newLookMatcher(needle, opts)
+	h.word = word
+	h.top = -1
+}
+
+func (ed *Editor) clearHighlight() {
+	ed.highlight.needle = nil
+	ed.highlight.matcher = nil
+	ed.highlight.word = false
+	ed.sfr.Fr.Highlights = nil
+}
+
+// Updates the highlights of all editors, called by the main loop
+func syncHighlights() {
+	if Wnd.cols == nil {
+		return
+	}
+	hlword := Wnd.Prop["hlword"] == "yes"
+	idle := time.Since(LastTypeTime) >= hlWordIdle
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			switch {
+			case hlword && !ed.eventChanSpecial:
+				syncWordHighlight(ed, idle)
+			case !hlword && ed.highlight.word:
+				ed.setHighlight(nil, lookOpts{}, false)
+			}
+			ed.updateHighlights()
+		}
+	}
+}
+
+func syncWordHighlight(ed *Editor, idle bool) {
+	sel := ed.sfr.Fr.Sel
+	if !ed.sfr.Fr.VisibleTick || sel.S != sel.E {
+		if ed.highlight.word {
+			ed.setHighlight(nil, lookOpts{}, false)
+		}
+		return
+	}
+	if !idle {
+		if ed.highlight.word {
+			ed.setHighlight(nil, lookOpts{}, false)
+		}
+		if hlWordTimer == nil {
+			hlWordTimer = time.AfterFunc(hlWordIdle, func() {
+				sideChan <- func() { hlWordTimer = nil }
+			})
+		}
+		return
+	}
+	w := wordAt(ed.bodybuf, sel.S)
+	if w.S == w.E {
+		ed.setHighlight(nil, lookOpts{}, false)
+		return
+	}
+	ed.setHighlight(ed.bodybuf.SelectionRunes(w), lookOpts{exact: true}, true)
+}
+
+// Recomputes the highlighted matches of ed if the needle, the visible text or the buffer changed
+func (ed *Editor) updateHighlights() {
+	h := &ed.highlight
+	fr := &ed.sfr.Fr
+	if len(h.needle) == 0 {
+		if len(fr.Highlights) > 0 {
+			fr.Highlights = nil
+			ed.BufferRefresh()
+		}
+		return
+	}
+	if h.top == fr.Top && h.size == fr.Size() && h.revCount == ed.bodybuf.RevCount {
+		return
+	}
+	h.top, h.size, h.revCount = fr.Top, fr.Size(), ed.bodybuf.RevCount
+
+	b := ed.bodybuf
+	end := fr.Top + fr.Size()
+	r := []util.Sel{}
+	// matches that start inside the visible text but end outside of it are also highlighted
+	for p := fr.Top - len(h.needle); ; {
+		if p < 0 {
+			p = 0
+		}
+		loc := h.matcher.match(b, p, end+len(h.needle))
+		if loc == nil || loc[0] >= end {
+			break
+		}
+		if !h.word || isWholeWord(b, loc[0], loc[1]) {
+			r = append(r, util.Sel{loc[0], loc[1]})
+		}
+		p = loc[1]
+	}
+	fr.Highlights = r
+	ed.BufferRefresh()
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || (c == '_')
+}
+
+// Returns the word containing p
+func wordAt(b *buf.Buffer, p int) util.Sel {
+	s, e := p, p
+	for s > 0 && isWordRune(b.At(s-1)) {
+		s--
+	}
+	for e < b.Size() && isWordRune(b.At(e)) {
+		e++
+	}
+	return util.Sel{s, e}
+}
+
+func isWholeWord(b *buf.Buffer, s, e int) bool {
+	return (s <= 0 || !isWordRune(b.At(s-1))) && (e >= b.Size() || !isWordRune(b.At(e)))
+}
+
+// colors for highlighted text: the text colors of plain, on the background of sel
+func highlightColors(plain, sel []image.Uniform) []image.Uniform {
+	r := append([]image.Uniform{}, plain...)
+	r[0] = sel[0]
+	return r
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	sysre "regexp"
+	"strings"
+	"time"
+
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
+)
+
+type saveHook struct {
+	bufRe *sysre.Regexp
+	kind  string
+	cmd   string
+}
+
+var saveHooks []saveHook
+
+// maximum time a formatter can run
+const fmtHookTimeout = 10 * time.Second
+
+func HooksInit() {
+	saveHooks = []saveHook{}
+	for _, hook := range config.SaveHooks {
+		re, err := sysre.Compile(hook.BufRe)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not compile hook regexp %q: %v\n", hook.BufRe, err)
+			continue
+		}
+		saveHooks = append(saveHooks, saveHook{re, hook.Kind, hook.Cmd})
+	}
+}
+
+func matchingHooks(ed *Editor, kind string) []saveHook {
+	path := filepath.Join(ed.bodybuf.Dir, ed.bodybuf.Name)
+	r := []saveHook{}
+	for _, hook := range saveHooks {
+		if hook.kind == kind && hook.bufRe.MatchString(path) {
+			r = append(r, hook)
+		}
+	}
+	return r
+}
+
+// Pipes the contents of ed through its formatters in the background, then applies their output and calls put on the main loop.
+// The buffer isn't saved if it was edited while the formatters were running.
+// Returns false, without calling put, if ed has no formatters
+func runFmtHooks(ed *Editor, put func()) bool {
+	hooks := matchingHooks(ed, "fmt")
+	if len(hooks) == 0 {
+		return false
+	}
+
+	dir, path, edid := ed.bodybuf.Dir, ed.bodybuf.Path(), ed.edid
+	in := string(ed.bodybuf.SelectionRunes(util.Sel{0, ed.bodybuf.Size()}))
+	rev := ed.bodybuf.RevCount
+
+	go func() {
+		out := in
+		errs := []string{}
+		for _, hook := range hooks {
+			r, err := runFmtHook(dir, path, edid, hook.cmd, out)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("Put: %s: %v\n", hook.cmd, err))
+				continue
+			}
+			out = r
+		}
+
+		sideChan <- func() {
+			for _, msg := range errs {
+				Warndir(dir, msg)
+			}
+			if ed.closed {
+				return
+			}
+			if ed.bodybuf.RevCount != rev {
+				Warndir(dir, fmt.Sprintf("Put: %s was modified while it was being formatted, not saved", ed.bodybuf.ShortName()))
+				return
+			}
+			ed.bodybuf.ReplaceMinimal([]rune(out), &util.Sel{0, ed.bodybuf.Size()}, true, ed.eventChan, util.EO_BODYTAG)
+			put()
+		}
+	}()
+	return true
+}
+
+func runFmtHook(dir, path string, edid int, cmdstr, in string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), fmtHookTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", cmdstr)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "p="+path, "%="+path, fmt.Sprintf("bi=%d", edid))
+	cmd.Stdin = strings.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%v\n%s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
+
+// Starts the linters of ed, called after the buffer is written
+func runLintHooks(ed *Editor) {
+	for _, hook := range matchingHooks(ed, "lint") {
+		ec := ExecContext{ed: ed, buf: ed.bodybuf, fr: &ed.sfr.Fr, br: ed.BufferRefresh, dir: ed.bodybuf.Dir}
+		NewJob(ed.bodybuf.Dir, hook.cmd, "", &ec, false, false, nil)
+	}
+}
@@ -74,6 +74,21 @@ CopyFrom=Main
 .	\w+	XLook $l0
 .	.+	XLook $l0
 
+[Hooks]
+### Executed by Put: fmt commands filter the buffer before saving, lint commands run after saving
+#\.go$	fmt	gofmt
+#\.go$	lint	go vet
+
+[Templates]
+### Templates used only for matching buffers, in addition to ~/.config/yacco/templates
+### in template files templates are separated by lines containing only ---, a template after a line containing only '--- snippet' can use tab stops (\$1, \${1:default}, \$0) and variables (\$FILENAME, \$SELECTION...)
+#\.go$	templates.go
+
+[Placement]
+### Where new editors go: regexp on the path, column (first, last, a number or beside <path>), position in the column (auto, top or bottom)
+#/\+(Errors|Jobs)$	last	bottom
+#^(.*)_test\.go$	beside \$1.go
+
 [Keybindings]
 control+`	Mark
 control+p	Savepos
@@ -81,6 +96,13 @@ control+d	Tooltip Go describe
 control+b	Jump
 control+.	|a+
 control+,	|a-
+#super+left_arrow	Focus left
+#super+right_arrow	Focus right
+#super+up_arrow	Focus up
+#super+down_arrow	Focus down
+#super+shift+right_arrow	Movecol next
+#super+shift+left_arrow	Movecol prev
+#super+m	Maximize
 
 EOF
 	fi
@@ -169,7 +191,7 @@ function install_cmfmt {
 
 function install_scripts {
 	echo install scripts
-	for scpt in m g a+ a- Font Indent Tab Mount Fs in LookExact comment_char.sh c+ c- yclear gg DiskDiff; do
+	for scpt in m g a+ a- Font Indent Tab Wrap osc52 Mount Fs in LookExact comment_char.sh c+ c- yclear gg DiskDiff; do
 		cp -f extra/$scpt $destdir/yaccodir/$scpt
 		chmod u+x $destdir/yaccodir/$scpt
 	done
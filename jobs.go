@@ -148,6 +148,8 @@ func NewJob(wd, cmd, input string, ec *ExecContext, writeToBuf, istooltip bool,
 	}
 	jobsMutex.Unlock()
 
+	jsonLog(&jsonLogEntry{Event: "job-start", Cmd: job.descr, Dir: wd, Job: &jsonLogJob{Id: idx, Pid: job.cmd.Process.Pid}})
+
 	UpdateJobs(false)
 
 	go func() {
@@ -215,8 +217,14 @@ func NewJob(wd, cmd, input string, ec *ExecContext, writeToBuf, istooltip bool,
 			doneSomething = true
 		}
 
+		jl := &jsonLogJob{Id: idx, Pid: job.cmd.Process.Pid, Duration: time.Since(job.startTime).Seconds()}
+		if err != nil {
+			jl.Error = err.Error()
+		}
+		jsonLog(&jsonLogEntry{Event: "job-end", Cmd: job.descr, Dir: job.cmd.Dir, Job: jl})
+
 		if (ec != nil) && job.writeToBuf {
-			sideChan <- ReplaceMsg(ec, nil, false, job.outstr, util.EO_BODYTAG, true, true)
+			sideChan <- ReplaceMsg(ec, nil, false, job.outstr, util.EO_BODYTAG, true, true, true)
 			doneSomething = true
 		} else if resultChan != nil {
 			resultChan <- job.outstr
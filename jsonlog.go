@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aarzilli/yacco/buf"
+)
+
+/*
+The jsonlog file is a structured version of the log file, each read returns a single JSON encoded entry.
+Readers that fall behind lose the oldest entries instead of being disconnected, the number of lost entries is reported with a "dropped" entry.
+*/
+
+// maximum number of entries queued for each reader of the jsonlog file
+const jsonLogBacklog = 1024
+
+type jsonLogEntry struct {
+	Time    time.Time       `json:"time"`
+	Event   string          `json:"event"`
+	Buffer  *jsonLogBuffer  `json:"buffer,omitempty"`
+	Cmd     string          `json:"cmd,omitempty"`
+	Dir     string          `json:"dir,omitempty"`
+	Job     *jsonLogJob     `json:"job,omitempty"`
+	Columns []jsonLogColumn `json:"columns,omitempty"`
+	Dropped int             `json:"dropped,omitempty"`
+}
+
+type jsonLogBuffer struct {
+	Id       int    `json:"id"`
+	Path     string `json:"path"`
+	Modified bool   `json:"modified"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+type jsonLogJob struct {
+	Id       int     `json:"id"`
+	Pid      int     `json:"pid"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration,omitempty"` // in seconds
+}
+
+type jsonLogColumn struct {
+	Frac    float64 `json:"frac"`
+	Editors []int   `json:"editors"`
+}
+
+type jsonLogReader struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	entries [][]byte
+	dropped int
+	closed  bool
+}
+
+var jsonLogMu sync.Mutex
+var jsonLogReaders = map[string]*jsonLogReader{}
+
+// layout of the window the last time it was checked by jsonLogLayout
+var jsonLogLastLayout string
+
+func openJsonLogFn(conn string) error {
+	r := &jsonLogReader{}
+	r.cond = sync.NewCond(&r.mu)
+	jsonLogMu.Lock()
+	jsonLogReaders[conn] = r
+	jsonLogMu.Unlock()
+	return nil
+}
+
+func readJsonLogFn(conn string) ([]byte, syscall.Errno) {
+	jsonLogMu.Lock()
+	r, ok := jsonLogReaders[conn]
+	jsonLogMu.Unlock()
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.entries) == 0 && r.dropped == 0 && !r.closed {
+		r.cond.Wait()
+	}
+	if r.dropped > 0 {
+		bs, _ := json.Marshal(&jsonLogEntry{Time: time.Now(), Event: "dropped", Dropped: r.dropped})
+		r.dropped = 0
+		return append(bs, '\n'), 0
+	}
+	if len(r.entries) == 0 {
+		return []byte{}, 0
+	}
+	bs := r.entries[0]
+	r.entries = r.entries[1:]
+	return bs, 0
+}
+
+func clunkJsonLogFn(conn string) error {
+	jsonLogMu.Lock()
+	r, ok := jsonLogReaders[conn]
+	delete(jsonLogReaders, conn)
+	jsonLogMu.Unlock()
+	if ok {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		r.cond.Broadcast()
+	}
+	return nil
+}
+
+func jsonLogActive() bool {
+	jsonLogMu.Lock()
+	defer jsonLogMu.Unlock()
+	return len(jsonLogReaders) > 0
+}
+
+// Sends e to all readers of the jsonlog file, can be called from any goroutine
+func jsonLog(e *jsonLogEntry) {
+	if !jsonLogActive() {
+		return
+	}
+	e.Time = time.Now()
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	bs = append(bs, '\n')
+
+	jsonLogMu.Lock()
+	defer jsonLogMu.Unlock()
+	for _, r := range jsonLogReaders {
+		r.mu.Lock()
+		if len(r.entries) >= jsonLogBacklog {
+			r.entries = r.entries[1:]
+			r.dropped++
+		}
+		r.entries = append(r.entries, bs)
+		r.mu.Unlock()
+		r.cond.Broadcast()
+	}
+}
+
+func jsonLogBufferOf(edid int, b *buf.Buffer) *jsonLogBuffer {
+	return &jsonLogBuffer{Id: edid, Path: filepath.Join(b.Dir, b.Name), Modified: b.Modified, Checksum: b.Checksum()}
+}
+
+func jsonLogExec(ec ExecContext, cmd string) {
+	if !jsonLogActive() {
+		return
+	}
+	e := &jsonLogEntry{Event: "exec", Cmd: cmd, Dir: ec.dir}
+	if ec.ed != nil {
+		e.Buffer = jsonLogBufferOf(ec.ed.edid, ec.ed.bodybuf)
+	}
+	jsonLog(e)
+}
+
+func jsonLogFocus(ed *Editor) {
+	if ed == nil || !jsonLogActive() {
+		return
+	}
+	jsonLog(&jsonLogEntry{Event: "focus", Buffer: jsonLogBufferOf(ed.edid, ed.bodybuf)})
+}
+
+// Logs the layout of the window if it changed since the last call, called by the main loop
+func jsonLogLayout() {
+	if !jsonLogActive() || Wnd.cols == nil {
+		return
+	}
+	cols := make([]jsonLogColumn, len(Wnd.cols.cols))
+	for i, col := range Wnd.cols.cols {
+		cols[i].Frac = col.frac / 10
+		cols[i].Editors = make([]int, len(col.editors))
+		for j, ed := range col.editors {
+			cols[i].Editors[j] = ed.edid
+		}
+	}
+	layout := fmt.Sprintf("%.4v", cols)
+	if layout == jsonLogLastLayout {
+		return
+	}
+	jsonLogLastLayout = layout
+	jsonLog(&jsonLogEntry{Event: "layout", Columns: cols})
+}
+
+// Changes the active editor and column
+func setActive(ed *Editor, col *Col) {
+	if ed != activeEditor {
+		jsonLogFocus(ed)
+	}
+	activeEditor = ed
+	activeCol = col
+}
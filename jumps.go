@@ -0,0 +1,192 @@
+package main
+
+import (
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+The jump history records the position the cursor was at before each jump made by a load rule (which is also how LookFile, go-to-definition and NextError open files).
+Back and Forward move through the history, positions are kept up to date while their buffer is open and files that were closed are reopened.
+*/
+
+// maximum number of positions in the jump history
+const jumpHistoryMax = 100
+
+type jumpPos struct {
+	path string
+	sel  util.Sel
+	b    *buf.Buffer // buffer sel is registered with, sel is no longer updated once b is closed
+}
+
+var jumpHistory []*jumpPos
+
+// index in jumpHistory of the position we moved to with Back and Forward, len(jumpHistory) if we didn't
+var jumpCur int
+
+// Returns the position of the cursor in ed, nil if ed isn't editing a file
+func currentJumpPos(ed *Editor) *jumpPos {
+	if ed == nil || ed.closed || fakebuf(ed.bodybuf.Name) {
+		return nil
+	}
+	return &jumpPos{path: ed.bodybuf.Path(), sel: ed.sfr.Fr.Sel}
+}
+
+func (jp *jumpPos) attach(b *buf.Buffer) {
+	jp.detach()
+	jp.b = b
+	b.AddSel(&jp.sel)
+}
+
+func (jp *jumpPos) detach() {
+	if jp.b != nil {
+		jp.b.RmSel(&jp.sel)
+		jp.b = nil
+	}
+}
+
+func (jp *jumpPos) near(other *jumpPos) bool {
+	if jp.path != other.path {
+		return false
+	}
+	d := jp.sel.S - other.sel.S
+	return d < JUMP_THRESHOLD && d > -JUMP_THRESHOLD
+}
+
+// Records a jump from the position of the cursor in from to ed, jumps inside the same file are only recorded if they are far enough
+func recordJump(from *jumpPos, ed *Editor) {
+	if from == nil {
+		return
+	}
+	if to := currentJumpPos(ed); to != nil && to.near(from) {
+		return
+	}
+
+	// positions after the current one are forgotten
+	if jumpCur < len(jumpHistory) {
+		for _, jp := range jumpHistory[jumpCur:] {
+			jp.detach()
+		}
+		jumpHistory = jumpHistory[:jumpCur]
+	}
+
+	if n := len(jumpHistory); n > 0 && jumpHistory[n-1].near(from) {
+		jumpHistory[n-1].detach()
+		jumpHistory = jumpHistory[:n-1]
+	}
+	if len(jumpHistory) >= jumpHistoryMax {
+		jumpHistory[0].detach()
+		jumpHistory = append(jumpHistory[:0], jumpHistory[1:]...)
+	}
+
+	jumpHistory = append(jumpHistory, from)
+	if fromed := openEditorFor(from.path); fromed != nil {
+		from.attach(fromed.bodybuf)
+		if ed != nil {
+			fromed.pushJump(from.sel)
+		}
+	}
+	jumpCur = len(jumpHistory)
+}
+
+// Adds sel to the jump ring of ed, unlike the jump history the ring is saved in dumps
+func (ed *Editor) pushJump(sel util.Sel) {
+	ed.restoredJump = (ed.restoredJump + 1) % NUM_JUMPS
+	ed.jumps[ed.restoredJump] = sel
+}
+
+// Moves the cursor of ed to the last position in its jump ring, the next call moves to the one before it
+func (ed *Editor) popJump() {
+	for i := 0; i < NUM_JUMPS; i++ {
+		sel := ed.jumps[ed.restoredJump]
+		ed.restoredJump = (ed.restoredJump + NUM_JUMPS - 1) % NUM_JUMPS
+		if sel.S < 0 {
+			continue
+		}
+		ed.sfr.Fr.Sel = sel
+		ed.bodybuf.FixSel(&ed.sfr.Fr.Sel)
+		ed.sfr.Fr.SelColor = 0
+		ed.BufferRefresh()
+		ed.Warp()
+		return
+	}
+}
+
+// Returns an editor for path if there is one open
+func openEditorFor(path string) *Editor {
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			if ed.bodybuf.Path() == path {
+				return ed
+			}
+		}
+	}
+	return nil
+}
+
+// Moves the cursor to jp, reopening its file if it was closed
+func gotoJumpPos(jp *jumpPos) bool {
+	ed := openEditorFor(jp.path)
+	if ed == nil || ed.bodybuf != jp.b {
+		// the buffer was closed, the last known position is used
+		jp.detach()
+		var err error
+		ed, err = EditFind(Wnd.tagbuf.Dir, jp.path, false, false)
+		if err != nil || ed == nil {
+			return false
+		}
+		jp.attach(ed.bodybuf)
+	}
+	ed.sfr.Fr.Sel = jp.sel
+	ed.bodybuf.FixSel(&ed.sfr.Fr.Sel)
+	ed.sfr.Fr.SelColor = 0
+	ed.BufferRefresh()
+	setActive(ed, nil)
+	ed.Warp()
+	return true
+}
+
+func jumpEditor(ec ExecContext) *Editor {
+	if ec.ed != nil && !fakebuf(ec.ed.bodybuf.Name) {
+		return ec.ed
+	}
+	return activeEditor
+}
+
+// Moves to the position before the last jump, without a jump history (for example after a restart) it cycles through the jump ring of the editor
+func BackCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	if len(jumpHistory) == 0 {
+		if ed := jumpEditor(ec); ed != nil {
+			ed.popJump()
+		}
+		return
+	}
+	if jumpCur <= 0 {
+		return
+	}
+	if jumpCur >= len(jumpHistory) {
+		// the current position is added so that Forward can return to it
+		if cur := currentJumpPos(jumpEditor(ec)); cur != nil && !cur.near(jumpHistory[len(jumpHistory)-1]) {
+			recordJump(cur, nil)
+		}
+		jumpCur = len(jumpHistory) - 1
+	}
+	for jumpCur > 0 {
+		jumpCur--
+		if gotoJumpPos(jumpHistory[jumpCur]) {
+			return
+		}
+	}
+}
+
+// Moves to the position we were at before executing Back
+func ForwardCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	for jumpCur < len(jumpHistory)-1 {
+		jumpCur++
+		if gotoJumpPos(jumpHistory[jumpCur]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	sysre "regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+Placement rules (see util.PlacementRule) decide where new editors go, editors not matched by any rule are placed by HeuristicPlaceEditor.
+Layouts are saved in the format of the columns file, with the paths of the buffers instead of editor ids.
+*/
+
+type placementRule struct {
+	bufRe    *sysre.Regexp
+	column   string
+	position string
+}
+
+var placementRules []placementRule
+
+const layoutExt = ".layout"
+
+func PlacementInit() {
+	placementRules = []placementRule{}
+	for _, rule := range config.PlacementRules {
+		re, err := sysre.Compile(rule.BufRe)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not compile placement regexp %q: %v\n", rule.BufRe, err)
+			continue
+		}
+		placementRules = append(placementRules, placementRule{re, rule.Column, rule.Position})
+	}
+}
+
+// Places ed according to the first placement rule that applies to it, returns false if no rule applies
+func placeEditorByRule(ed *Editor) bool {
+	path := ed.bodybuf.Path()
+	for _, rule := range placementRules {
+		m := rule.bufRe.FindStringSubmatchIndex(path)
+		if m == nil {
+			continue
+		}
+
+		var col *Col
+		after := -1
+		switch {
+		case rule.column == "first":
+			col = Wnd.cols.cols[0]
+		case rule.column == "last":
+			col = Wnd.cols.cols[len(Wnd.cols.cols)-1]
+		case strings.HasPrefix(rule.column, "beside "):
+			other := string(rule.bufRe.ExpandString(nil, strings.TrimSpace(rule.column[len("beside "):]), path, m))
+			col, after = findEditorByPath(util.ResolvePath(ed.bodybuf.Dir, other))
+			if col == nil {
+				continue
+			}
+		default:
+			n, _ := strconv.Atoi(rule.column)
+			if n < 1 {
+				n = 1
+			}
+			if n > len(Wnd.cols.cols) {
+				n = len(Wnd.cols.cols)
+			}
+			col = Wnd.cols.cols[n-1]
+		}
+
+		switch {
+		case rule.position == "top":
+			col.AddFirst(ed)
+		case rule.position == "bottom":
+			col.AddAfter(ed, -1, -1, true)
+		case after >= 0:
+			col.AddAfter(ed, after, -1, true)
+		default:
+			heuristicAddEditor(col, ed)
+		}
+		return true
+	}
+	return false
+}
+
+// Returns the column containing the editor for path and its index in the column
+func findEditorByPath(path string) (*Col, int) {
+	for _, col := range Wnd.cols.cols {
+		for i, ed := range col.editors {
+			if ed.bodybuf.Path() == path {
+				return col, i
+			}
+		}
+	}
+	return nil, -1
+}
+
+// Writes the layout of the window in the format of the columns file, editors are represented by ident
+func writeColumns(w io.Writer, ident func(ed *Editor) string) {
+	fmt.Fprintf(w, "sz")
+
+	for i := range Wnd.cols.cols {
+		fmt.Fprintf(w, " %0.4f", Wnd.cols.cols[i].frac/10)
+	}
+
+	fmt.Fprintf(w, "\n")
+
+	for i := range Wnd.cols.cols {
+		fmt.Fprintf(w, "%d", i)
+		for j := range Wnd.cols.cols[i].editors {
+			fmt.Fprintf(w, " %s", ident(Wnd.cols.cols[i].editors[j]))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
+
+func layoutsDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "yacco", "layouts")
+}
+
+func layoutPath(name string) string {
+	return filepath.Join(layoutsDir(), name+layoutExt)
+}
+
+func layoutIdent(ed *Editor) string {
+	p := ed.bodybuf.Path()
+	if strings.ContainsAny(p, " \t\n'\"\\") {
+		return util.SingleQuote(p)
+	}
+	return p
+}
+
+func saveLayout(path string) error {
+	os.MkdirAll(filepath.Dir(path), 0700)
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fh)
+	writeColumns(w, layoutIdent)
+	if err := w.Flush(); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// Reads a layout file, returns the width of each column and the paths of the buffers it contains
+func readLayout(path string) (fracs []float64, cols [][]string, err error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fh.Close()
+
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		v := util.QuotedSplit(scan.Text())
+		if len(v) == 0 {
+			continue
+		}
+		if v[0] == "sz" {
+			for _, s := range v[1:] {
+				f, _ := strconv.ParseFloat(s, 64)
+				if f < 0 {
+					f = 0
+				}
+				fracs = append(fracs, f)
+			}
+			continue
+		}
+		if _, err := strconv.Atoi(v[0]); err != nil {
+			return nil, nil, fmt.Errorf("malformed line %q", scan.Text())
+		}
+		cols = append(cols, v[1:])
+	}
+	if err := scan.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("no columns")
+	}
+	return fracs, cols, nil
+}
+
+// Rearranges the editors as described by a layout file, buffers that aren't open are opened, editors not in the layout stay in their column (or the last one)
+func restoreLayout(fracs []float64, paths [][]string) {
+	type placed struct {
+		ed  *Editor
+		col int
+	}
+	open := []placed{}
+	for i, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			open = append(open, placed{ed, i})
+		}
+		col.editors = col.editors[:0]
+	}
+
+	for len(Wnd.cols.cols) > len(paths) {
+		if activeCol == Wnd.cols.cols[len(Wnd.cols.cols)-1] {
+			activeCol = nil
+		}
+		Wnd.cols.cols = Wnd.cols.cols[:len(Wnd.cols.cols)-1]
+	}
+	for len(Wnd.cols.cols) < len(paths) {
+		Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), -1, 0.4)
+	}
+
+	take := func(path string) *Editor {
+		for i := range open {
+			if open[i].ed != nil && open[i].ed.bodybuf.Path() == path {
+				ed := open[i].ed
+				open[i].ed = nil
+				return ed
+			}
+		}
+		return nil
+	}
+
+	for i, colpaths := range paths {
+		col := Wnd.cols.cols[i]
+		for _, path := range colpaths {
+			ed := take(path)
+			if ed == nil {
+				if fakebuf(filepath.Base(path)) {
+					continue
+				}
+				var err error
+				ed, err = editOpen(path, false)
+				if err != nil {
+					Warn("Layout: " + err.Error())
+					continue
+				}
+				Log(ed.edid, LOP_NEW, ed.bodybuf)
+			}
+			col.AddAfter(ed, -1, -1, true)
+		}
+	}
+
+	for _, p := range open {
+		if p.ed == nil {
+			continue
+		}
+		i := p.col
+		if i >= len(Wnd.cols.cols) {
+			i = len(Wnd.cols.cols) - 1
+		}
+		Wnd.cols.cols[i].AddAfter(p.ed, -1, -1, true)
+	}
+
+	for _, col := range Wnd.cols.cols {
+		col.equalizeEditors()
+	}
+
+	if len(fracs) == len(Wnd.cols.cols) {
+		for i, f := range fracs {
+			Wnd.cols.cols[i].frac = f * 10
+		}
+	}
+
+	Wnd.cols.RecalcRects()
+	Wnd.RedrawHard()
+}
+
+func LayoutCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	v := strings.Fields(arg)
+	if len(v) == 0 {
+		listLayouts()
+		return
+	}
+	if len(v) != 2 || strings.Contains(v[1], "/") {
+		Warn("Layout: wrong arguments, use Layout save <name> or Layout restore <name>")
+		return
+	}
+
+	switch v[0] {
+	case "save":
+		if err := saveLayout(layoutPath(v[1])); err != nil {
+			Warn("Layout: " + err.Error())
+		}
+	case "restore":
+		fracs, paths, err := readLayout(layoutPath(v[1]))
+		if err != nil {
+			Warn(fmt.Sprintf("Layout: could not restore %s: %v", v[1], err))
+			return
+		}
+		restoreLayout(fracs, paths)
+	default:
+		Warn("Layout: unknown subcommand " + v[0])
+	}
+}
+
+func listLayouts() {
+	dh, err := os.Open(layoutsDir())
+	if err != nil {
+		Warn("Layout: no layouts saved")
+		return
+	}
+	defer dh.Close()
+
+	var fis fileInfoSortByTime
+	fis, err = dh.Readdir(-1)
+	if err != nil {
+		fis = []os.FileInfo{}
+	}
+	sort.Sort(fis)
+
+	r := []string{}
+	for i := range fis {
+		n := fis[i].Name()
+		if !strings.HasSuffix(n, layoutExt) {
+			continue
+		}
+		r = append(r, fmt.Sprintf("Layout restore %s", n[:len(n)-len(layoutExt)]))
+	}
+
+	wd, _ := os.Getwd()
+	ed, err := EditFind(wd, "+Layouts", false, true)
+	if err != nil {
+		Warn("Layout: " + err.Error())
+		return
+	}
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(strings.Join(r, "\n")+"\n"), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+}
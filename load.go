@@ -180,6 +180,10 @@ func (rule *LoadRule) Exec(ec ExecContext, matches []string, s, e int) bool {
 		if len(v) > 1 {
 			addrExpr = expandMatches(v[1], matches)
 		}
+		from := currentJumpPos(ec.ed)
+		if from == nil && activeEditor != ec.ed {
+			from = currentJumpPos(activeEditor)
+		}
 		var newed *Editor
 		if name != "" {
 			var err error
@@ -208,6 +212,7 @@ func (rule *LoadRule) Exec(ec ExecContext, matches []string, s, e int) bool {
 			}()
 			newed.BufferRefresh()
 		}
+		recordJump(from, newed)
 		newed.Warp()
 		return true
 	}
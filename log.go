@@ -1,12 +1,17 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
 )
 
 /*
@@ -33,6 +38,10 @@ const (
 )
 
 func Log(wid int, op LogOperation, buf *buf.Buffer) {
+	if op != LOP_PUT && op != LOP_GET {
+		// logged by PutCmd and GetCmd after the file is written or read, so that the checksum is up to date
+		jsonLog(&jsonLogEntry{Event: string(op), Buffer: jsonLogBufferOf(wid, buf)})
+	}
 	s := fmt.Sprintf("%d %s %s\n", wid, op, filepath.Join(buf.Dir, buf.Name))
 	d := 1 * time.Second
 	t := time.NewTimer(d)
@@ -50,21 +59,141 @@ func Log(wid int, op LogOperation, buf *buf.Buffer) {
 	t.Stop()
 }
 
+const historyTimeFormat = "20060102 15:04"
+const historySep = " ### "
+const maxHistoryShown = 200
+
+// history lines hold one command each, newlines in commands are escaped
+var historyEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var historyUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+
 func LogExec(cmd, dir string) {
-	History = append(History, HistoryEntry{time.Now(), cmd, dir})
+	h := HistoryEntry{time.Now(), cmd, dir}
+	History = append(History, h)
+	historyAppend(h)
+}
+
+func historyPath() string {
+	return os.ExpandEnv(config.HistoryFile)
 }
 
-func HistoryWrite() {
-	fh, err := os.OpenFile(os.ExpandEnv("$HOME/longhistory"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+// Appends h to the history file immediately, so that other running
+// instances can see it
+func historyAppend(h HistoryEntry) {
+	fh, err := os.OpenFile(historyPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Could not save history: %v\n", err)
 		return
 	}
 	defer fh.Close()
 
-	pid := os.Getpid()
+	fmt.Fprintf(fh, "%d %s%s%s %s\n", os.Getpid(), historyEscaper.Replace(h.Cmd), historySep, h.When.Format(historyTimeFormat), h.Dir)
+}
+
+// Reads the history file, if the file can not be read returns the history
+// of this session
+func historyRead() []HistoryEntry {
+	fh, err := os.Open(historyPath())
+	if err != nil {
+		return History
+	}
+	defer fh.Close()
+
+	r := []HistoryEntry{}
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		if h, ok := historyParse(scan.Text()); ok {
+			r = append(r, h)
+		}
+	}
+	return r
+}
 
-	for _, h := range History {
-		fmt.Fprintf(fh, "%d %s ### %s %s\n", pid, h.Cmd, h.When.Format("20060102 15:04"), h.Dir)
+func historyParse(line string) (h HistoryEntry, ok bool) {
+	sep := strings.LastIndex(line, historySep)
+	if sep < 0 {
+		return h, false
+	}
+	v := strings.SplitN(line[:sep], " ", 2)
+	if len(v) != 2 {
+		return h, false
+	}
+	h.Cmd = historyUnescaper.Replace(v[1])
+	rest := line[sep+len(historySep):]
+	if len(rest) < len(historyTimeFormat)+1 {
+		return h, false
+	}
+	var err error
+	h.When, err = time.ParseInLocation(historyTimeFormat, rest[:len(historyTimeFormat)], time.Local)
+	if err != nil {
+		return h, false
+	}
+	h.Dir = rest[len(historyTimeFormat)+1:]
+	return h, true
+}
+
+// Splits a line of the +History buffer into command and directory
+func historyLineSplit(line string) (cmd, dir string, ok bool) {
+	sep := strings.LastIndex(line, historySep)
+	if sep < 0 {
+		return "", "", false
+	}
+	cmd = strings.TrimSpace(line[:sep])
+	dir = strings.TrimSpace(line[sep+len(historySep):])
+	if cmd == "" || dir == "" {
+		return "", "", false
+	}
+	return historyUnescaper.Replace(cmd), dir, true
+}
+
+// Returns the lines of +History for entries, only the entries whose command or directory match re (if not nil) are listed
+func historyShown(entries []HistoryEntry, re *regexp.Regexp) []string {
+	// most recent entries go last, repeated commands are only shown once
+	seen := map[HistoryEntry]bool{}
+	r := []string{}
+	for i := len(entries) - 1; i >= 0 && len(r) < maxHistoryShown; i-- {
+		k := HistoryEntry{Cmd: entries[i].Cmd, Dir: entries[i].Dir}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if re != nil && !re.MatchString(k.Cmd) && !re.MatchString(k.Dir) {
+			continue
+		}
+		r = append(r, historyEscaper.Replace(k.Cmd)+historySep+k.Dir)
+	}
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return r
+}
+
+func HistoryCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	var re *regexp.Regexp
+	if arg = strings.TrimSpace(arg); arg != "" {
+		var err error
+		re, err = regexp.Compile(arg)
+		if err != nil {
+			Warn("History: " + err.Error())
+			return
+		}
+	}
+
+	r := historyShown(historyRead(), re)
+
+	ed, err := EditFind(Wnd.tagbuf.Dir, "+History", false, true)
+	if err != nil {
+		Warn("History: " + err.Error())
+		return
+	}
+	txt := strings.Join(r, "\n")
+	if txt != "" {
+		txt += "\n"
 	}
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(txt), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{ed.bodybuf.Size(), ed.bodybuf.Size()}
+	ed.BufferRefresh()
 }
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"fmt"
 	"unicode"
 
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/edit"
+	"github.com/aarzilli/yacco/regexp"
 	"github.com/aarzilli/yacco/util"
 )
 
+// commands added to the tag of an editor in interactive Look mode
+const lookTag = " Look!Replace Look!ReplaceAll Look!Skip Look!Case Look!Regexp"
+
+// matches are counted up to this number
+const lookCountMax = 10000
+
+type lookOpts struct {
+	exact  bool // case sensitive even if the needle doesn't contain upper case letters
+	regexp bool // the needle is a regular expression
+}
+
 func exactMatch(needle []rune) bool {
 	for _, r := range needle {
 		if unicode.IsUpper(r) {
@@ -15,33 +30,67 @@ func exactMatch(needle []rune) bool {
 	return false
 }
 
-func lookfwdEx(ed *Editor, needle []rune, start int, exact bool) bool {
+// A search for needle, regular expressions are compiled once and reused for all matches
+type lookMatcher struct {
+	needle []rune
+	exact  bool
+	regexp bool
+	re     *regexp.Regex // nil if the regular expression doesn't compile
+}
+
+func newLookMatcher(needle []rune, opts lookOpts) *lookMatcher {
+	lm := &lookMatcher{needle: needle, exact: opts.exact || exactMatch(needle), regexp: opts.regexp}
+	if opts.regexp && len(needle) > 0 {
+		lm.re = compileLookRegexp(needle)
+	}
+	return lm
+}
+
+func compileLookRegexp(needle []rune) (re *regexp.Regex) {
+	defer func() {
+		// the needle is often an incomplete regular expression while it is being typed
+		if ierr := recover(); ierr != nil {
+			re = nil
+		}
+	}()
+	return regexp.Compile(string(needle), true, false)
+}
+
+// Returns the first match of needle between start and end (-1 for the end of the buffer), for regular expressions submatches follow, nil if there is no match
+func lookMatch(b *buf.Buffer, needle []rune, start, end int, opts lookOpts) []int {
+	return newLookMatcher(needle, opts).match(b, start, end)
+}
+
+// Like lookMatch
+func (lm *lookMatcher) match(b *buf.Buffer, start, end int) []int {
+	needle, exact := lm.needle, lm.exact
 	if len(needle) <= 0 {
-		return true
+		return nil
+	}
+	if end < 0 || end > b.Size() {
+		end = b.Size()
 	}
 
-	if !exact {
-		exact = exactMatch(needle)
+	if lm.regexp {
+		return lm.matchRegexp(b, start, end)
 	}
 
 	j := 0
 	i := start
 	for {
-		if i >= ed.bodybuf.Size() {
+		if i >= end {
 			break
 		}
 		match := false
 		if exact {
-			match = (ed.bodybuf.At(i) == needle[j])
+			match = (b.At(i) == needle[j])
 		} else {
-			match = (unicode.ToLower(ed.bodybuf.At(i)) == needle[j])
+			match = (unicode.ToLower(b.At(i)) == needle[j])
 		}
 		if match {
 			j++
 			if j >= len(needle) {
-				ed.sfr.Fr.Sel.S = i - j + 1
-				ed.sfr.Fr.Sel.E = i + 1
-				return true
+				return []int{i - j + 1, i + 1}
 			}
 		} else {
 			i -= j
@@ -49,23 +98,97 @@ func lookfwdEx(ed *Editor, needle []rune, start int, exact bool) bool {
 		}
 		i++
 	}
-	return false
+	return nil
+}
+
+// Buffer folded to lower case, for case insensitive regexp searches
+type lowerMatchable struct {
+	b *buf.Buffer
+}
+
+func (m lowerMatchable) Size() int {
+	return m.b.Size()
 }
 
-func lookfwd(ed *Editor, needle []rune, fromEnd bool, exact bool) {
+func (m lowerMatchable) At(i int) rune {
+	return unicode.ToLower(m.b.At(i))
+}
+
+func (lm *lookMatcher) matchRegexp(b *buf.Buffer, start, end int) []int {
+	if lm.re == nil {
+		return nil
+	}
+	var m regexp.Matchable = b
+	if !lm.exact {
+		m = lowerMatchable{b}
+	}
+	for start <= end {
+		loc := lm.re.Match(m, start, end, +1)
+		if loc == nil || loc[0] != loc[1] {
+			return loc
+		}
+		// empty matches are skipped
+		start = loc[1] + 1
+	}
+	return nil
+}
+
+func lookfwdEx(ed *Editor, needle []rune, start int, opts lookOpts) bool {
+	if len(needle) <= 0 {
+		return true
+	}
+	loc := lookMatch(ed.bodybuf, needle, start, -1, opts)
+	if loc == nil {
+		return false
+	}
+	ed.sfr.Fr.Sel.S = loc[0]
+	ed.sfr.Fr.Sel.E = loc[1]
+	return true
+}
+
+func lookfwd(ed *Editor, needle []rune, fromEnd bool, opts lookOpts) {
 	start := ed.sfr.Fr.Sel.S
 	if fromEnd {
 		start = ed.sfr.Fr.Sel.E
 	}
 	ed.sfr.Fr.Sel.S = ed.sfr.Fr.Sel.E
 	ed.BufferRefresh()
-	if !lookfwdEx(ed, needle, start, exact) {
-		lookfwdEx(ed, needle, 0, exact)
+	if !lookfwdEx(ed, needle, start, opts) {
+		lookfwdEx(ed, needle, 0, opts)
 	}
 	ed.BufferRefresh()
 	ed.Warp()
 }
 
+// Replaces sel with replacement if it is a match of lm, returns the position of the inserted text
+func lookReplace(ed *Editor, sel util.Sel, lm *lookMatcher, replacement []rune, solid bool) (util.Sel, bool) {
+	loc := lm.match(ed.bodybuf, sel.S, -1)
+	if loc == nil || loc[0] != sel.S || loc[1] != sel.E {
+		return sel, false
+	}
+	text := replacement
+	if lm.regexp {
+		var err error
+		text, err = lookSubst(replacement, ed.bodybuf, loc)
+		if err != nil {
+			Warn("Look: " + err.Error())
+			return sel, false
+		}
+	}
+	// no events are sent, the event channel of ed belongs to lookproc and changes to the body would end the search
+	ed.bodybuf.Replace(text, &sel, solid, nil, util.EO_KBD)
+	return util.Sel{sel.S - len(text), sel.S}, true
+}
+
+func lookSubst(replacement []rune, b *buf.Buffer, loc []int) (r []rune, err error) {
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			err = fmt.Errorf("%v", ierr)
+		}
+	}()
+	return edit.ResolveBackreferences(replacement, b, loc), nil
+}
+
 var lastNeedle []rune
 
 func lookproc(ec ExecContext) {
@@ -76,12 +199,19 @@ func lookproc(ec ExecContext) {
 		return
 	}
 
-	exact := Wnd.Prop["lookexact"] == "yes"
+	sideChan <- func() {
+		ec.ed.specialTag = lookTag
+		ec.ed.BufferRefresh()
+	}
+
+	opts := lookOpts{exact: Wnd.Prop["lookexact"] == "yes"}
 
 	var er util.EventReader
 
 	needle := []rune{}
+	replacement := []rune{}
 	matches := []util.Sel{}
+	first := true // the first replacement starts an undo group, the following ones are added to it
 	for {
 		eventMsg, ok := <-ch
 		if !ok {
@@ -110,12 +240,72 @@ func lookproc(ec ExecContext) {
 		case util.ET_BODYEXEC, util.ET_TAGEXEC:
 			cmd, _ := er.Text(nil, nil, nil)
 			switch cmd {
-			case "Look!Again":
+			case "Look!Again", "Look!Skip":
 				sideChan <- func() {
-					lookfwd(ec.ed, needle, true, exact)
+					lookfwd(ec.ed, needle, true, opts)
 					if ec.fr.Sel.S != ec.fr.Sel.E {
 						matches = append(matches, ec.fr.Sel)
 					}
+					lookShow(ec.ed, needle, opts)
+				}
+
+			case "Look!Replace":
+				needle, replacement, opts := needle, replacement, opts
+				sideChan <- func() {
+					if sel, ok := lookReplace(ec.ed, ec.fr.Sel, newLookMatcher(needle, opts), replacement, first); ok {
+						first = false
+						ec.fr.Sel = util.Sel{sel.E, sel.E}
+						matches = matches[:0]
+					}
+					lookfwd(ec.ed, needle, true, opts)
+					if ec.fr.Sel.S != ec.fr.Sel.E {
+						matches = append(matches, ec.fr.Sel)
+					}
+					lookShow(ec.ed, needle, opts)
+				}
+
+			case "Look!ReplaceAll":
+				needle, replacement, opts := needle, replacement, opts
+				sideChan <- func() {
+					lm := newLookMatcher(needle, opts)
+					sel := util.Sel{0, 0}
+					replaced := false
+					for {
+						loc := lm.match(ec.ed.bodybuf, sel.E, -1)
+						if loc == nil {
+							break
+						}
+						nsel, ok := lookReplace(ec.ed, util.Sel{loc[0], loc[1]}, lm, replacement, first)
+						if !ok {
+							break
+						}
+						first = false
+						sel = nsel
+						replaced = true
+					}
+					if replaced {
+						ec.fr.Sel = sel
+						matches = matches[:0]
+					}
+					ec.ed.BufferRefresh()
+					ec.ed.Warp()
+					lookShow(ec.ed, needle, opts)
+				}
+
+			case "Look!Case", "Look!Regexp":
+				if cmd == "Look!Case" {
+					opts.exact = !opts.exact
+				} else {
+					opts.regexp = !opts.regexp
+				}
+				matches = matches[0:0]
+				needle, opts := needle, opts
+				sideChan <- func() {
+					lookfwd(ec.ed, needle, false, opts)
+					if ec.fr.Sel.S != ec.fr.Sel.E {
+						matches = append(matches, ec.fr.Sel)
+					}
+					lookShow(ec.ed, needle, opts)
 				}
 
 			case "Look!Quit", "Escape", "Return":
@@ -131,6 +321,7 @@ func lookproc(ec ExecContext) {
 						matches = matches[:len(matches)-1]
 						ec.ed.BufferRefresh()
 						ec.ed.Warp()
+						lookShow(ec.ed, needle, opts)
 					}
 				}
 
@@ -141,19 +332,21 @@ func lookproc(ec ExecContext) {
 			}
 
 		case util.ET_TAGINS, util.ET_TAGDEL:
-			newNeedle := getTagText(ec.ed)
+			newNeedle, newReplacement := splitLookTag(getTagText(ec.ed))
 			doAppend := false
 			if !runeEquals(newNeedle, needle) {
 				doAppend = true
 				matches = matches[0:0]
 			}
 			needle = newNeedle
+			replacement = newReplacement
 			lastNeedle = needle
 			sideChan <- func() {
-				lookfwd(ec.ed, needle, false, exact)
+				lookfwd(ec.ed, needle, false, opts)
 				if doAppend && (ec.fr.Sel.S != ec.fr.Sel.E) {
 					matches = append(matches, ec.fr.Sel)
 				}
+				lookShow(ec.ed, needle, opts)
 			}
 		}
 	}
@@ -161,6 +354,52 @@ func lookproc(ec ExecContext) {
 	ec.ed.ExitSpecial(savedTag, savedEventChan)
 }
 
+// Highlights the visible matches of needle and shows the number of matches in the tag
+func lookShow(ed *Editor, needle []rune, opts lookOpts) {
+	ed.setHighlight(needle, opts, false)
+	tag := lookTag
+	if len(needle) > 0 {
+		cur, total := lookCount(ed.bodybuf, needle, opts, ed.sfr.Fr.Sel)
+		more := ""
+		if total >= lookCountMax {
+			more = "+"
+		}
+		tag += fmt.Sprintf(" %d/%d%s", cur, total, more)
+	}
+	if tag != ed.specialTag {
+		ed.specialTag = tag
+		ed.BufferRefresh()
+	}
+}
+
+// Counts the matches of needle, cur is the index (starting at 1) of the match at sel, 0 if sel isn't a match
+func lookCount(b *buf.Buffer, needle []rune, opts lookOpts, sel util.Sel) (cur, total int) {
+	lm := newLookMatcher(needle, opts)
+	p := 0
+	for total < lookCountMax {
+		loc := lm.match(b, p, -1)
+		if loc == nil {
+			break
+		}
+		total++
+		if loc[0] == sel.S && loc[1] == sel.E {
+			cur = total
+		}
+		p = loc[1]
+	}
+	return cur, total
+}
+
+// Splits the text typed in the tag during interactive Look into the needle and, after a tab, its replacement
+func splitLookTag(tag []rune) (needle, replacement []rune) {
+	for i, r := range tag {
+		if r == '\t' {
+			return tag[:i], tag[i+1:]
+		}
+	}
+	return tag, []rune{}
+}
+
 func getTagText(ed *Editor) []rune {
 	done := make(chan []rune)
 	sideChan <- func() {
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+Bookmarks are named positions in a file, set with 'Mark <name>'. While the file is open they move with the text like the selections of the buffer.
+They are saved in ~/.config/yacco/bookmarks when they change, when the file is saved and when yacco exits, and can be used in the Edit language as 'name.
+The bookmarks file contains offsets in the file as it is on disk: while a buffer has unsaved changes its bookmarks are saved at the position they had when the buffer was last unmodified (bookmarks set after that at their current position).
+*/
+
+// bookmarks by path of the file and name
+var bookmarks = map[string]map[string]*jumpPos{}
+
+// position of each bookmark in the file on disk, bookmarks set while their buffer is modified are missing until it is saved and are written at their current position
+var bookmarksOnDisk = map[*jumpPos]util.Sel{}
+
+func bookmarksPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "yacco", "bookmarks")
+}
+
+func validBookmarkName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, ch := range name {
+		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the bookmarks file, each line contains the name of a bookmark, its start and end and the path of the file
+func BookmarksInit() {
+	bookmarks = map[string]map[string]*jumpPos{}
+	bookmarksOnDisk = map[*jumpPos]util.Sel{}
+
+	fh, err := os.Open(bookmarksPath())
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		v := strings.SplitN(scan.Text(), "\t", 4)
+		if len(v) != 4 || !validBookmarkName(v[0]) {
+			continue
+		}
+		s, err1 := strconv.Atoi(v[1])
+		e, err2 := strconv.Atoi(v[2])
+		if err1 != nil || err2 != nil || s < 0 || e < s {
+			continue
+		}
+		if bookmarks[v[3]] == nil {
+			bookmarks[v[3]] = map[string]*jumpPos{}
+		}
+		jp := &jumpPos{path: v[3], sel: util.Sel{s, e}}
+		bookmarks[v[3]][v[0]] = jp
+		bookmarksOnDisk[jp] = jp.sel
+	}
+}
+
+func saveBookmarks() {
+	path := bookmarksPath()
+	os.MkdirAll(filepath.Dir(path), 0700)
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		Warn("Could not save bookmarks: " + err.Error())
+		return
+	}
+	defer fh.Close()
+
+	w := bufio.NewWriter(fh)
+	for _, bm := range sortedBookmarks() {
+		if bm.jp.b == nil || !bm.jp.b.Modified {
+			bookmarksOnDisk[bm.jp] = bm.jp.sel
+		}
+		sel, ok := bookmarksOnDisk[bm.jp]
+		if !ok {
+			// set while the buffer was modified, its current position is the best we have
+			sel = bm.jp.sel
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", bm.name, sel.S, sel.E, bm.jp.path)
+	}
+	if err := w.Flush(); err != nil {
+		Warn("Could not save bookmarks: " + err.Error())
+	}
+}
+
+// Saves the bookmarks if path has any
+func saveBookmarksOf(path string) {
+	if len(bookmarks[path]) > 0 {
+		saveBookmarks()
+	}
+}
+
+type namedBookmark struct {
+	name string
+	jp   *jumpPos
+}
+
+func sortedBookmarks() []namedBookmark {
+	r := []namedBookmark{}
+	for _, m := range bookmarks {
+		for name, jp := range m {
+			r = append(r, namedBookmark{name, jp})
+		}
+	}
+	sort.Sort(bookmarksByPos(r))
+	return r
+}
+
+type bookmarksByPos []namedBookmark
+
+func (v bookmarksByPos) Len() int      { return len(v) }
+func (v bookmarksByPos) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v bookmarksByPos) Less(i, j int) bool {
+	if v[i].jp.path != v[j].jp.path {
+		return v[i].jp.path < v[j].jp.path
+	}
+	return v[i].jp.sel.S < v[j].jp.sel.S
+}
+
+func setBookmark(name string, jp *jumpPos) {
+	delBookmark(jp.path, name)
+	if bookmarks[jp.path] == nil {
+		bookmarks[jp.path] = map[string]*jumpPos{}
+	}
+	bookmarks[jp.path][name] = jp
+	if ed := openEditorFor(jp.path); ed != nil {
+		jp.attach(ed.bodybuf)
+	}
+}
+
+func delBookmark(path, name string) bool {
+	jp, ok := bookmarks[path][name]
+	if !ok {
+		return false
+	}
+	jp.detach()
+	delete(bookmarksOnDisk, jp)
+	delete(bookmarks[path], name)
+	if len(bookmarks[path]) == 0 {
+		delete(bookmarks, path)
+	}
+	return true
+}
+
+// Makes the bookmarks of the file loaded in b follow its edits, called when a new editor is created
+func attachBookmarks(b *buf.Buffer) {
+	if fakebuf(b.Name) {
+		return
+	}
+	for _, jp := range bookmarks[b.Path()] {
+		if jp.b != b {
+			if sel, ok := bookmarksOnDisk[jp]; ok && jp.b != nil && jp.b.Modified {
+				// the changes made to the previous buffer of the file after it was saved were discarded
+				jp.sel = sel
+			}
+			jp.attach(b)
+			b.FixSel(&jp.sel)
+		}
+	}
+}
+
+// Returns the bookmark called name, looking first in the file of ed and then in all other files
+func findBookmark(ed *Editor, name string) *jumpPos {
+	if ed != nil {
+		if jp, ok := bookmarks[ed.bodybuf.Path()][name]; ok {
+			return jp
+		}
+	}
+	for _, bm := range sortedBookmarks() {
+		if bm.name == name {
+			return bm.jp
+		}
+	}
+	return nil
+}
+
+// Implements addresses like 'name in the Edit language
+func bookmarkAddr(b *buf.Buffer, name string) (util.Sel, bool) {
+	jp, ok := bookmarks[b.Path()][name]
+	if !ok {
+		return util.Sel{}, false
+	}
+	return jp.sel, true
+}
+
+// Writes the list of bookmarks to +Marks, as file:line entries that can be opened with a right click
+func listBookmarks() {
+	r := []string{}
+	for _, bm := range sortedBookmarks() {
+		line := ""
+		if ed := openEditorFor(bm.jp.path); ed != nil && ed.bodybuf == bm.jp.b {
+			ln, _ := ed.bodybuf.GetLine(bm.jp.sel.S)
+			line = ":" + strconv.Itoa(ln)
+		} else if ln, ok := lineOfOffset(bm.jp.path, bm.jp.sel.S); ok {
+			line = ":" + strconv.Itoa(ln)
+		}
+		r = append(r, fmt.Sprintf("%s%s\t%s", bm.jp.path, line, bm.name))
+	}
+
+	wd, _ := os.Getwd()
+	ed, err := EditFind(wd, "+Marks", false, true)
+	if err != nil {
+		Warn("Marks: " + err.Error())
+		return
+	}
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(strings.Join(r, "\n")+"\n"), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+}
+
+// Returns the line containing the character at offset p of a file that isn't open
+func lineOfOffset(path string, p int) (int, bool) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	ln := 1
+	for _, ch := range string(bs) {
+		if p <= 0 {
+			break
+		}
+		if ch == '\n' {
+			ln++
+		}
+		p--
+	}
+	return ln, true
+}
+
+// Lists bookmarks in +Marks
+func MarksCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	listBookmarks()
+}
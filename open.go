@@ -68,6 +68,14 @@ func HeuristicPlaceEditor(ed *Editor, warp bool) {
 		Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), -1, 0.4)
 	}
 
+	if placeEditorByRule(ed) {
+		Wnd.FlushImage()
+		if warp {
+			ed.Warp()
+		}
+		return
+	}
+
 	var col *Col = nil
 
 	if ed.bodybuf.Name[0] == '+' {
@@ -106,6 +114,16 @@ func HeuristicPlaceEditor(ed *Editor, warp bool) {
 		}
 	}
 
+	heuristicAddEditor(col, ed)
+
+	Wnd.FlushImage()
+	if warp {
+		ed.Warp()
+	}
+}
+
+// Adds ed to col, below the editor with the most empty space or, if no editor has enough empty space, below the biggest editor
+func heuristicAddEditor(col *Col, ed *Editor) {
 	if len(col.editors) <= 0 {
 		col.AddAfter(ed, -1, -1, true)
 	} else {
@@ -131,11 +149,6 @@ func HeuristicPlaceEditor(ed *Editor, warp bool) {
 			col.AddAfter(ed, col.IndexOf(biged), -1, true)
 		}
 	}
-
-	Wnd.FlushImage()
-	if warp {
-		ed.Warp()
-	}
 }
 
 func Warnfull(bufname, msg string, clear bool, selectit bool) {
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/hl"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+The outline of a buffer lists its functions, methods and types in +Outline, one per line preceded by file:line so that they can be opened with a right click.
+Go files are parsed with go/parser, for other files the lines containing text highlighted as a header (hl.RMT_HEADER) by the rules in config.LanguageRules are listed.
+An outline is rewritten every time its file is saved.
+*/
+
+type outlineEntry struct {
+	line int
+	text string
+}
+
+// path of the file of each outline buffer
+var outlineSources = map[*buf.Buffer]string{}
+
+func goOutline(b *buf.Buffer) ([]outlineEntry, error) {
+	fset := token.NewFileSet()
+	src := string(b.SelectionRunes(util.Sel{0, b.Size()}))
+	f, err := parser.ParseFile(fset, b.Name, src, 0)
+	if f == nil {
+		return nil, err
+	}
+
+	r := []outlineEntry{}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			text := "func " + decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				text = fmt.Sprintf("func (%s) %s", types.ExprString(decl.Recv.List[0].Type), decl.Name.Name)
+			}
+			r = append(r, outlineEntry{fset.Position(decl.Pos()).Line, text})
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				kind := ""
+				switch spec.Type.(type) {
+				case *ast.StructType:
+					kind = " struct"
+				case *ast.InterfaceType:
+					kind = " interface"
+				}
+				r = append(r, outlineEntry{fset.Position(spec.Pos()).Line, "type " + spec.Name.Name + kind})
+			}
+		}
+	}
+	return r, nil
+}
+
+// Returns the lines of b containing a header
+func headerOutline(b *buf.Buffer) []outlineEntry {
+	r := []outlineEntry{}
+	colors := b.Highlight(0, b.Size())
+	line := 1
+	for i := 0; i < len(colors); i++ {
+		ch := b.At(i)
+		if ch == '\n' {
+			line++
+			continue
+		}
+		if colors[i] != uint8(hl.RMT_HEADER) {
+			continue
+		}
+		ls, le := lineAt(b, i)
+		r = append(r, outlineEntry{line, outlineText(string(b.SelectionRunes(util.Sel{ls, le})))})
+		if le >= b.Size() {
+			break
+		}
+		// continue from the start of the next line
+		line++
+		i = le - 1
+	}
+	return r
+}
+
+// Returns line without surrounding spaces and the { or : that opens a block
+func outlineText(line string) string {
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line), "{:"))
+}
+
+// Writes the outline of the file of ed to +Outline
+func outline(ed *Editor, warp bool) {
+	b := ed.bodybuf
+	var entries []outlineEntry
+	if strings.HasSuffix(b.Name, ".go") {
+		var err error
+		entries, err = goOutline(b)
+		if err != nil && entries == nil {
+			Warn("Outline: " + err.Error())
+			return
+		}
+	} else {
+		entries = headerOutline(b)
+	}
+
+	out := make([]string, len(entries))
+	for i, entry := range entries {
+		out[i] = fmt.Sprintf("%s:%d\t%s", b.Name, entry.line, entry.text)
+	}
+
+	outed, err := EditFind(b.Dir, "+Outline", warp, true)
+	if err != nil {
+		Warn("Outline: " + err.Error())
+		return
+	}
+	outlineSources[outed.bodybuf] = b.Path()
+	outed.sfr.Fr.Sel = util.Sel{0, outed.bodybuf.Size()}
+	outed.bodybuf.Replace([]rune(strings.Join(out, "\n")+"\n"), &outed.sfr.Fr.Sel, true, nil, 0)
+	outed.sfr.Fr.Sel = util.Sel{0, 0}
+	outed.BufferRefresh()
+}
+
+// Rewrites the outlines of the file of ed, called after ed is saved
+func refreshOutlines(ed *Editor) {
+	if len(outlineSources) == 0 {
+		return
+	}
+	open := map[*buf.Buffer]bool{}
+	for _, col := range Wnd.cols.cols {
+		for _, ced := range col.editors {
+			open[ced.bodybuf] = true
+		}
+	}
+	refresh := false
+	for outb, path := range outlineSources {
+		switch {
+		case !open[outb]:
+			delete(outlineSources, outb)
+		case path == ed.bodybuf.Path():
+			refresh = true
+		}
+	}
+	if refresh {
+		outline(ed, false)
+	}
+}
+
+// Lists functions, methods and types of the current file in +Outline
+func OutlineCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := ec.ed
+	if ed == nil {
+		ed = activeEditor
+	}
+	if ed == nil {
+		return
+	}
+	if path, ok := outlineSources[ed.bodybuf]; ok {
+		// executed from the outline, it is regenerated
+		ed = openEditorFor(path)
+		if ed == nil {
+			Warn("Outline: " + path + " is not open")
+			return
+		}
+	}
+	if fakebuf(ed.bodybuf.Name) {
+		Warn("Outline: " + ed.bodybuf.Name + " is not a file")
+		return
+	}
+	outline(ed, true)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
+)
+
+const recoverExt = ".rec"
+
+// extension of the file containing the pid of the instance writing a recovery file
+const recoverOwnerExt = ".pid"
+
+// recovery files written by this instance, indexed by path of the buffer, with the revision they were written at
+var recoverWritten = map[string]int{}
+
+func recoverDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "yacco", "recover")
+}
+
+func recoverPath(path string) string {
+	return filepath.Join(recoverDir(), url.QueryEscape(path)+recoverExt)
+}
+
+// Returns true if the recovery file of path is being written by another instance of yacco that is still running
+func recoverOwnerAlive(path string) bool {
+	bs, err := ioutil.ReadFile(recoverPath(path) + recoverOwnerExt)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	err = syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func recoverRemove(path string) {
+	os.Remove(recoverPath(path))
+	os.Remove(recoverPath(path) + recoverOwnerExt)
+}
+
+func autosaveLoop() {
+	if config.AutosaveInterval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(config.AutosaveInterval) * time.Second)
+		sideChan <- autosave
+	}
+}
+
+// Writes the contents of every modified buffer to the recovery directory, removes recovery files of buffers that are no longer modified
+func autosave() {
+	modified := map[string]*buf.Buffer{}
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			b := ed.bodybuf
+			if b.Modified && !fakebuf(b.Name) && !b.IsDir() {
+				modified[b.Path()] = b
+			}
+		}
+	}
+
+	for path := range recoverWritten {
+		if modified[path] == nil {
+			recoverRemove(path)
+			delete(recoverWritten, path)
+		}
+	}
+
+	if len(modified) == 0 {
+		return
+	}
+
+	os.MkdirAll(recoverDir(), 0700)
+
+	for path, b := range modified {
+		if rev, ok := recoverWritten[path]; ok && rev == b.RevCount {
+			continue
+		}
+		ba, bb := b.Selection(util.Sel{0, b.Size()})
+		dest := recoverPath(path)
+		if ioutil.WriteFile(dest+recoverOwnerExt, []byte(strconv.Itoa(os.Getpid())), 0600) != nil {
+			continue
+		}
+		if ioutil.WriteFile(dest+"~", []byte(string(ba)+string(bb)), 0600) != nil {
+			continue
+		}
+		if os.Rename(dest+"~", dest) != nil {
+			continue
+		}
+		recoverWritten[path] = b.RevCount
+	}
+}
+
+// Removes all recovery files written by this instance, called when the user explicitly discards their changes
+func recoverCleanup() {
+	for path := range recoverWritten {
+		recoverRemove(path)
+	}
+	recoverWritten = map[string]int{}
+}
+
+// Returns the list of files that have recovery data newer than their contents on disk, files still being autosaved by other running instances are skipped
+func recoverCandidates() []string {
+	dh, err := os.Open(recoverDir())
+	if err != nil {
+		return nil
+	}
+	defer dh.Close()
+
+	var fis fileInfoSortByTime
+	fis, err = dh.Readdir(-1)
+	if err != nil {
+		return nil
+	}
+	sort.Sort(fis)
+
+	r := []string{}
+	for _, fi := range fis {
+		if !strings.HasSuffix(fi.Name(), recoverExt) {
+			continue
+		}
+		path, err := url.QueryUnescape(fi.Name()[:len(fi.Name())-len(recoverExt)])
+		if err != nil {
+			continue
+		}
+		if _, ok := recoverWritten[path]; ok {
+			continue
+		}
+		if recoverOwnerAlive(path) {
+			continue
+		}
+		if ofi, err := os.Stat(path); err == nil {
+			if !fi.ModTime().After(ofi.ModTime()) {
+				continue
+			}
+			rbs, err1 := ioutil.ReadFile(recoverPath(path))
+			obs, err2 := ioutil.ReadFile(path)
+			if err1 == nil && err2 == nil && bytes.Equal(rbs, obs) {
+				recoverRemove(path)
+				continue
+			}
+		}
+		r = append(r, path)
+	}
+	return r
+}
+
+func RecoverCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	v := strings.SplitN(strings.TrimSpace(arg), " ", 2)
+	switch {
+	case v[0] == "":
+		recoverList(false)
+	case len(v) == 2 && v[0] == "diff":
+		recoverDiff(strings.TrimSpace(v[1]))
+	case len(v) == 2 && v[0] == "discard":
+		path := strings.TrimSpace(v[1])
+		if recoverOwnerAlive(path) {
+			Warn("Recover: " + path + " is being edited by another running instance")
+			return
+		}
+		recoverRemove(path)
+		recoverList(false)
+	default:
+		recoverRestore(strings.TrimSpace(arg))
+	}
+}
+
+// Lists recovery candidates in +Recover, if quiet is set nothing is shown when there are no candidates
+func recoverList(quiet bool) {
+	paths := recoverCandidates()
+	if len(paths) == 0 && quiet {
+		return
+	}
+
+	t := "Nothing to recover\n"
+	if len(paths) > 0 {
+		t = "The following files have unsaved changes from a previous session:\n"
+	}
+	for _, path := range paths {
+		modtime := ""
+		if fi, err := os.Stat(recoverPath(path)); err == nil {
+			modtime = fi.ModTime().Format("2006-01-02 15:04")
+		}
+		t += fmt.Sprintf("\n%s (%s)\n\tRecover %s\n\tRecover diff %s\n\tRecover discard %s\n", util.ShortPath(path, true), modtime, path, path, path)
+	}
+
+	wd, _ := os.Getwd()
+	ed, err := EditFind(wd, "+Recover", false, true)
+	if err != nil {
+		Warn("Recover: " + err.Error())
+		return
+	}
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(t), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+}
+
+func recoverDiff(path string) {
+	rec := recoverPath(path)
+	if _, err := os.Stat(rec); err != nil {
+		Warn("Recover: no recovery data for " + path)
+		return
+	}
+	orig := path
+	if _, err := os.Stat(orig); err != nil {
+		orig = "/dev/null"
+	}
+
+	resultChan := make(chan string)
+	NewJob(filepath.Dir(path), "diff -u "+util.SingleQuote(orig)+" "+util.SingleQuote(rec)+" || true", "", &ExecContext{}, false, false, resultChan)
+	go func() {
+		out := <-resultChan
+		sideChan <- func() {
+			Warnfull(filepath.Join(filepath.Dir(path), "+Diff"), out, true, false)
+		}
+	}()
+}
+
+func recoverRestore(path string) {
+	if recoverOwnerAlive(path) {
+		Warn("Recover: " + path + " is being edited by another running instance")
+		return
+	}
+	bs, err := ioutil.ReadFile(recoverPath(path))
+	if err != nil {
+		Warn("Recover: no recovery data for " + path)
+		return
+	}
+
+	ed, err := EditFind(filepath.Dir(path), filepath.Base(path), false, true)
+	if err != nil {
+		Warn("Recover: " + err.Error())
+		return
+	}
+
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(string(bs)), &ed.sfr.Fr.Sel, true, ed.eventChan, util.EO_MOUSE)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+	recoverWritten[path] = -1
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+A snippet is a template with tab stops (see util.ExpandSnippet), templates are snippets only if they are marked as such in their file (see config.readTemplates). After a snippet is inserted the first tab stop is selected and Tab moves to the next one.
+The positions of the tab stops are registered as selections of the buffer and kept up to date by snippetBufferEvent, text typed at the end of the current stop is added to it.
+Stops with the same number mirror each other, they are updated by the main loop after every event.
+The snippet ends when the last stop is reached or the cursor moves out of the current stop.
+*/
+
+type snippetSession struct {
+	ed      *Editor
+	sels    []*util.Sel // tab stops in the order they appear in the buffer, followed by the end of the snippet
+	stops   [][]int     // indices in sels of the tab stops, in the order Tab visits them, the first of each is edited by the user, the others mirror it
+	final   int         // index in sels of the position of the cursor after the last tab stop
+	cur     int         // index in stops of the current tab stop
+	editing int         // index in sels of the stop being changed
+}
+
+// only one snippet can be active at a time
+var snippet *snippetSession
+
+// Variables available to templates
+func snippetVars(b *buf.Buffer, selection string) map[string]string {
+	path := filepath.Join(b.Dir, b.Name)
+	name := filepath.Base(b.Name)
+	return map[string]string{
+		"SELECTION": selection,
+		"FILENAME":  name,
+		"FILEBASE":  strings.TrimSuffix(name, filepath.Ext(name)),
+		"FILEPATH":  path,
+		"DIR":       b.Dir,
+	}
+}
+
+// Replaces sel with the expansion of tmpl and, if it has tab stops and it is inserted in the body of ec.ed, selects the first one
+func insertSnippet(ec ExecContext, sel util.Sel, tmpl util.Template, indent, selection string) {
+	endSnippet()
+	txt, stops := tmpl.Expand(indent, snippetVars(ec.buf, selection))
+	text := []rune(txt)
+	ec.fr.Sel = sel
+	ec.buf.Replace(text, &ec.fr.Sel, true, ec.eventChan, util.EO_KBD)
+	if ec.ed == nil || ec.buf != ec.ed.bodybuf || len(stops) == 0 {
+		return
+	}
+
+	sn := &snippetSession{ed: ec.ed, final: -1}
+	stopidx := map[int]int{}
+	for i, stop := range stops {
+		sn.sels = append(sn.sels, &util.Sel{sel.S + stop.S, sel.S + stop.E})
+		if stop.N == 0 {
+			if sn.final < 0 {
+				sn.final = i
+			}
+			continue
+		}
+		j, ok := stopidx[stop.N]
+		if !ok {
+			j = len(sn.stops)
+			stopidx[stop.N] = j
+			sn.stops = append(sn.stops, nil)
+		}
+		sn.stops[j] = append(sn.stops[j], i)
+	}
+	sn.sels = append(sn.sels, &util.Sel{sel.S + len(text), sel.S + len(text)})
+	if sn.final < 0 {
+		sn.final = len(sn.sels) - 1
+	}
+	// tab stops are visited in numeric order
+	for i := 1; i < len(sn.stops); i++ {
+		for j := i; j > 0 && stops[sn.stops[j][0]].N < stops[sn.stops[j-1][0]].N; j-- {
+			sn.stops[j], sn.stops[j-1] = sn.stops[j-1], sn.stops[j]
+		}
+	}
+
+	for _, s := range sn.sels {
+		ec.buf.AddSel(s)
+	}
+	snippet = sn
+	if len(sn.stops) == 0 {
+		ec.fr.Sel = *sn.sels[sn.final]
+		endSnippet()
+		return
+	}
+	sn.editing = sn.stops[0][0]
+	ec.fr.Sel = *sn.sels[sn.editing]
+}
+
+func snippetActive(ed *Editor) bool {
+	return snippet != nil && snippet.ed == ed
+}
+
+// Selects the next tab stop of the active snippet, after the last one the cursor is moved to the end of the snippet and the snippet ends
+func snippetNext() {
+	sn := snippet
+	syncSnippets()
+	if snippet != sn {
+		return
+	}
+	sn.cur++
+	if sn.cur < len(sn.stops) {
+		sn.editing = sn.stops[sn.cur][0]
+		sn.ed.sfr.Fr.Sel = *sn.sels[sn.editing]
+		return
+	}
+	p := sn.sels[sn.final].E
+	sn.ed.sfr.Fr.Sel = util.Sel{p, p}
+	endSnippet()
+}
+
+func endSnippet() {
+	if snippet == nil {
+		return
+	}
+	for _, s := range snippet.sels {
+		snippet.ed.bodybuf.RmSel(s)
+	}
+	snippet = nil
+}
+
+// Extends the stop being edited with text inserted at its end, stops following it that start at the same position are moved after the text
+func snippetBufferEvent(b *buf.Buffer, origin util.EventOrigin, etype util.EventType, s, e int, text string) {
+	sn := snippet
+	if sn == nil || b != sn.ed.bodybuf || etype != util.ET_BODYINS {
+		return
+	}
+	cur := sn.sels[sn.editing]
+	if cur.S > s || cur.E != s {
+		return
+	}
+	n := len([]rune(text))
+	cur.E += n
+	for _, other := range sn.sels[sn.editing+1:] {
+		if other.S == s {
+			other.S += n
+			if other.E == s {
+				other.E += n
+			}
+		}
+	}
+}
+
+// Copies the current tab stop to its mirrors and ends the snippet if the cursor is no longer inside it, called by the main loop
+func syncSnippets() {
+	sn := snippet
+	if sn == nil {
+		return
+	}
+	if sn.ed.closed || sn.cur >= len(sn.stops) {
+		endSnippet()
+		return
+	}
+	stop := sn.stops[sn.cur]
+	cur := sn.sels[stop[0]]
+	if sel := sn.ed.sfr.Fr.Sel; sel.S < cur.S || sel.E > cur.E {
+		endSnippet()
+		return
+	}
+
+	b := sn.ed.bodybuf
+	text := b.SelectionRunes(*cur)
+	changed := false
+	for _, i := range stop[1:] {
+		mirror := sn.sels[i]
+		if string(b.SelectionRunes(*mirror)) == string(text) {
+			continue
+		}
+		sn.editing = i
+		sel := *mirror
+		b.Replace(text, &sel, false, sn.ed.eventChan, util.EO_KBD)
+		changed = true
+	}
+	sn.editing = stop[0]
+	if changed {
+		sn.ed.BufferRefresh()
+	}
+}
+
+// Inserts the first template that starts with arg, the selection is replaced and can be used by snippets as $SELECTION
+func TemplateCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	col2active(&ec)
+	if ec.ed == nil {
+		return
+	}
+	ec.ed.confirmDel = false
+	ec.ed.confirmSave = false
+
+	arg = strings.TrimSpace(arg)
+	b := ec.ed.bodybuf
+	vars := snippetVars(b, "")
+	var tmpl util.Template
+	for _, t := range config.TemplatesFor(filepath.Join(b.Dir, b.Name)) {
+		if txt, _ := t.Expand("", vars); strings.HasPrefix(txt, arg) {
+			tmpl = t
+			break
+		}
+	}
+	if tmpl.Text == "" {
+		Warn("Template: no template matching " + arg)
+		return
+	}
+
+	ec.fr = &ec.ed.sfr.Fr
+	ec.buf = b
+	ec.br = ec.ed.BufferRefresh
+	sel := ec.fr.Sel
+	ls := b.Tonl(sel.S-1, -1)
+	indent := []rune{}
+	for i := ls; i < sel.S && (b.At(i) == ' ' || b.At(i) == '\t'); i++ {
+		indent = append(indent, b.At(i))
+	}
+	insertSnippet(ec, sel, tmpl, string(indent), string(b.SelectionRunes(sel)))
+	if ec.br != nil && !ec.norefresh {
+		ec.br()
+	}
+}
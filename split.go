@@ -0,0 +1,251 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/edutil"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+Two editors can have their scrolling locked together: when one of them scrolls by some lines the other one scrolls by the same amount, or to the line returned by its align function if it has one.
+Locks are checked by the main loop after every event, changes of the top of an editor caused by edits to its buffer are not propagated.
+*/
+
+// Opens a zerox of the current editor in the adjacent column, at the same height
+func SplitCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := ec.ed
+	if ed == nil {
+		ed = activeSel.zeroxEd
+	}
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil {
+		return
+	}
+	ed.confirmDel = false
+	ed.confirmSave = false
+
+	lock := false
+	switch strings.TrimSpace(arg) {
+	case "":
+	case "lock":
+		lock = true
+	default:
+		Warn("Split: wrong argument " + arg)
+		return
+	}
+
+	ned := NewEditor(ed.bodybuf)
+	ned.sfr.Fr.Sel = ed.sfr.Fr.Sel
+	ned.otherSel[OS_TOP].E = ed.otherSel[OS_TOP].E
+	Log(ed.edid, LOP_ZEROX, ed.bodybuf)
+
+	placeBeside(ed, ned)
+	if lock {
+		lockScroll(ed, ned)
+	}
+	Wnd.FlushImage()
+	ned.Warp()
+}
+
+// Toggles the scroll lock between the current editor and the one next to it in the adjacent column
+func LockscrollCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	if ec.ed == nil {
+		return
+	}
+	if ec.ed.scrollLock.ed != nil {
+		unlockScroll(ec.ed)
+		return
+	}
+	col := ec.ed.Column()
+	if col == nil {
+		return
+	}
+	dstcol := adjacentCol(col)
+	if dstcol == nil {
+		Warn("Lockscroll: no adjacent column")
+		return
+	}
+	var other *Editor
+	best := 0
+	for _, ed := range dstcol.editors {
+		if o := overlap(ec.ed.r.Min.Y, ec.ed.r.Max.Y, ed.r.Min.Y, ed.r.Max.Y); o > best {
+			other, best = ed, o
+		}
+	}
+	if other == nil {
+		Warn("Lockscroll: no editor next to " + ec.ed.bodybuf.ShortName())
+		return
+	}
+	lockScroll(ec.ed, other)
+}
+
+// Returns the column to the right of col, or the one to its left if col is the last column
+func adjacentCol(col *Col) *Col {
+	i := Wnd.cols.IndexOf(col)
+	switch {
+	case i < 0:
+		return nil
+	case i+1 < len(Wnd.cols.cols):
+		return Wnd.cols.cols[i+1]
+	case i > 0:
+		return Wnd.cols.cols[i-1]
+	}
+	return nil
+}
+
+func overlap(s1, e1, s2, e2 int) int {
+	if s2 > s1 {
+		s1 = s2
+	}
+	if e2 < e1 {
+		e1 = e2
+	}
+	return e1 - s1
+}
+
+// Places ned in the column next to the one of ed at the same height, a new column is created if there is only one
+func placeBeside(ed, ned *Editor) {
+	col := ed.Column()
+	dstcol := adjacentCol(col)
+	if dstcol == nil {
+		dstcol = Wnd.cols.AddAfter(NewCol(&Wnd, Wnd.cols.r), Wnd.cols.IndexOf(col), 0.5)
+	}
+	addEditorAt(dstcol, ned, ed.r.Min.Y)
+}
+
+// Adds ed to col, splitting the editor at height y
+func addEditorAt(col *Col, ed *Editor, y int) {
+	if len(col.editors) == 0 {
+		col.AddAfter(ed, -1, -1, true)
+		return
+	}
+	dsted := col.editors[len(col.editors)-1]
+	for _, ced := range col.editors {
+		if y < ced.r.Max.Y {
+			dsted = ced
+			break
+		}
+	}
+
+	// same adjustments EditorMove does for the destination position
+	wobble := false
+	if dsted.size < ed.MinHeight()+dsted.MinHeight() {
+		wobble = true
+	} else {
+		if dsted.r.Max.Y-y < ed.MinHeight() {
+			y = dsted.r.Max.Y - ed.MinHeight()
+		}
+		if my := dsted.r.Min.Y + dsted.MinHeight(); y < my {
+			y = my
+		}
+	}
+	col.AddAfter(ed, col.IndexOf(dsted), y, wobble)
+}
+
+func lockScroll(a, b *Editor) {
+	unlockScroll(a)
+	unlockScroll(b)
+	a.scrollLock.ed = b
+	b.scrollLock.ed = a
+	a.resetScrollLock()
+	b.resetScrollLock()
+}
+
+func unlockScroll(ed *Editor) {
+	if other := ed.scrollLock.ed; other != nil && other.scrollLock.ed == ed {
+		other.scrollLock.ed = nil
+		other.scrollLock.align = nil
+	}
+	ed.scrollLock.ed = nil
+	ed.scrollLock.align = nil
+}
+
+func (ed *Editor) resetScrollLock() {
+	ed.scrollLock.top = ed.otherSel[OS_TOP].E
+	ed.scrollLock.revCount = ed.bodybuf.RevCount
+}
+
+// Propagates scrolling between locked editors, called by the main loop
+func syncScrollLocks() {
+	if Wnd.cols == nil {
+		return
+	}
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			other := ed.scrollLock.ed
+			if other == nil {
+				continue
+			}
+			if other.closed {
+				unlockScroll(ed)
+				continue
+			}
+			if ed.bodybuf.RevCount != ed.scrollLock.revCount {
+				ed.resetScrollLock()
+				continue
+			}
+			top := ed.otherSel[OS_TOP].E
+			if top == ed.scrollLock.top {
+				continue
+			}
+			if ed.scrollLock.align != nil {
+				ln, _ := ed.bodybuf.GetLine(top)
+				ed.resetScrollLock()
+				other.scrollToLine(ed.scrollLock.align(ln - 1))
+			} else {
+				n := countLines(ed, ed.scrollLock.top, top)
+				ed.resetScrollLock()
+				other.scrollLines(n)
+			}
+		}
+	}
+}
+
+// Returns the number of lines between positions a and b, negative if b is before a
+func countLines(ed *Editor, a, b int) int {
+	sign := 1
+	if b < a {
+		a, b = b, a
+		sign = -1
+	}
+	return sign * strings.Count(string(ed.bodybuf.SelectionRunes(util.Sel{a, b})), "\n")
+}
+
+// Scrolls the editor by n lines (backwards if n is negative) without propagating the change to the editor it is locked with
+func (ed *Editor) scrollLines(n int) {
+	top := ed.otherSel[OS_TOP].E
+	for ; n > 0 && top < ed.bodybuf.Size(); n-- {
+		top = ed.bodybuf.Tonl(top, +1)
+	}
+	for ; n < 0 && top > 0; n++ {
+		top = ed.bodybuf.Tonl(top-2, -1)
+	}
+	ed.scrollTo(top)
+}
+
+// Scrolls the editor so that line ln (counting from 0) is the first one, without propagating the change to the editor it is locked with
+func (ed *Editor) scrollToLine(ln int) {
+	ed.scrollTo(lineOffset(ed.bodybuf, ln))
+}
+
+func (ed *Editor) scrollTo(top int) {
+	// Scrollfn moves to the start of the line containing its argument, top-1 is the newline before top
+	edutil.Scrollfn(ed.bodybuf, &ed.otherSel[OS_TOP], &ed.sfr, 0, top-1)
+	ed.resetScrollLock()
+}
+
+// Returns the position of the start of line ln (counting from 0) of b
+func lineOffset(b *buf.Buffer, ln int) int {
+	p := 0
+	for ; ln > 0 && p < b.Size(); ln-- {
+		p = b.Tonl(p, +1)
+	}
+	return p
+}
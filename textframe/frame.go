@@ -6,6 +6,7 @@ import (
 	"image/draw"
 	"math"
 	"runtime"
+	"strconv"
 	"time"
 
 	"github.com/aarzilli/yacco/otat"
@@ -38,6 +39,13 @@ const (
 	HF_AUTOINDENT_SOFTWRAP
 )
 
+// Kinds of gutter
+const (
+	GUTTER_NONE     = iota
+	GUTTER_ABSOLUTE // shows line numbers
+	GUTTER_RELATIVE // shows line numbers relative to the line containing the cursor
+)
+
 type Frame struct {
 	Font            font.Face
 	otatm           *otat.Machine
@@ -50,16 +58,24 @@ type Frame struct {
 	Flush           func(...image.Rectangle)
 	Scroll          FrameScrollFn
 	ExpandSelection ExpandSelectionFn
+	Colorfn         func(start, end int) []uint8 // if set, replaces the highlighter of the buffer when coloring the text
 	Top             int
 	Tabs            []int
 
+	Gutter       int // kind of gutter to draw on the left side of the frame
+	GutterDigits int // minimum number of digits of the numbers in the gutter
+	FirstLine    int // line number of the first character in the frame, used to number lines in the gutter
+	Ruler        int // if greater than 0 a vertical line is drawn after this column
+
 	margin            fixed.Int26_6
 	minimumDragForSel int
 	Offset            int
 
-	Sel      util.Sel
-	SelColor int
-	PMatch   util.Sel
+	Sel        util.Sel
+	SelColor   int
+	PMatch     util.Sel
+	Highlights []util.Sel // sorted, non overlapping, drawn with the sixth row of Colors if it exists
+	Folds      []util.Sel // sorted, non overlapping, the text inside a fold is hidden and its first character is drawn as FoldRune
 
 	glyphs   []glyph
 	ins      fixed.Point26_6
@@ -69,10 +85,12 @@ type Frame struct {
 		drawnVisibleTick bool
 		drawnSel         util.Sel
 		drawnPMatch      util.Sel
+		drawnHighlights  []util.Sel
 		selColor         int
 		reloaded         bool
 		scrollStart      int
 		scrollEnd        int
+		cursorLine       int
 	}
 
 	scrubGlyph image.Alpha
@@ -91,6 +109,8 @@ The first selection is mandatory and if it is empty a tick (a vertical bar) is d
 The color matrix must have as many rows as there are selections (empty or otherwise) in the frame plus one. In each row there must be at least two colors: the color at index 0 is the background color, the color at index 1 is the default foreground color. All other colors are foreground colors used as specified when using InsertColor.
 
 The very first row of the color matrix are the colors used for unselected text.
+
+The fifth row of the color matrix, if present, is used for PMatch, the sixth one, if present, is used for Highlights.
 */
 
 type glyph struct {
@@ -100,8 +120,12 @@ type glyph struct {
 	widthy   fixed.Int26_6
 	p        fixed.Point26_6
 	color    uint8
+	foldedr  rune // if not 0 the glyph is inside a fold and foldedr is the character it hides
 }
 
+// Drawn in place of the text inside a fold
+const FoldRune = '…'
+
 // Initializes frame
 func (fr *Frame) Init(margin int) error {
 	fr.margin = fixed.I(margin)
@@ -158,10 +182,29 @@ func (fr *Frame) BytesSize() uintptr {
 
 func (fr *Frame) initialInsPoint() fixed.Point26_6 {
 	p := fixed.P(fr.R.Min.X+fr.Offset, fr.R.Min.Y+fr.Font.Metrics().Ascent.Floor())
-	p.X += fr.margin
+	p.X += fr.margin + fr.gutterWidth()
 	return p
 }
 
+func (fr *Frame) setMargins() {
+	fr.rightMargin = fixed.I(fr.R.Max.X) - fr.margin
+	fr.leftMargin = fr.textLeft() + fixed.I(fr.Offset)
+}
+
+// Returns the leftmost coordinate where text can be drawn
+func (fr *Frame) textLeft() fixed.Int26_6 {
+	return fixed.I(fr.R.Min.X) + fr.margin + fr.gutterWidth()
+}
+
+// Returns the rectangle where text can be drawn, when the frame is scrolled horizontally text must not be drawn over the gutter
+func (fr *Frame) textR() image.Rectangle {
+	r := fr.R
+	if fr.Offset != 0 {
+		r.Min.X = fr.textLeft().Floor()
+	}
+	return r
+}
+
 func (fr *Frame) Clear() {
 	fr.ins = fr.initialInsPoint()
 	fr.glyphs = fr.glyphs[:0]
@@ -169,6 +212,7 @@ func (fr *Frame) Clear() {
 	fr.redrawOpt.reloaded = true
 	fr.redrawOpt.scrollStart = -1
 	fr.redrawOpt.scrollEnd = -1
+	fr.redrawOpt.cursorLine = fr.cursorLine()
 }
 
 // Inserts text into the frame, returns the maximum X and Y used
@@ -178,8 +222,7 @@ func (fr *Frame) Insert(r1, r2 []rune) (limit image.Point) {
 
 	prevRune, hasPrev := rune(0), false
 
-	fr.rightMargin = fixed.I(fr.R.Max.X) - fr.margin
-	fr.leftMargin = fixed.I(fr.R.Min.X) + fr.margin
+	fr.setMargins()
 	bottom := fixed.I(fr.R.Max.Y) + lh
 
 	_, _, _, spaceWidth, _ := fr.Font.Glyph(fixed.P(0, 0), ' ')
@@ -203,6 +246,7 @@ func (fr *Frame) Insert(r1, r2 []rune) (limit image.Point) {
 	})
 
 	autoindentMargin := fixed.Int26_6(0)
+	fold := 0
 
 	for fr.otatm.Next() {
 		i, glyphidx, crune := fr.otatm.Glyph()
@@ -222,6 +266,26 @@ func (fr *Frame) Insert(r1, r2 []rune) (limit image.Point) {
 			fr.lastFull = len(fr.glyphs)
 		}
 
+		if p := fr.Top + len(fr.glyphs); fr.inFold(&fold, p) {
+			g := glyph{
+				r:        ' ',
+				fakerune: true,
+				p:        fr.ins,
+				color:    1,
+				foldedr:  crune,
+			}
+			if p == fr.Folds[fold].S || len(fr.glyphs) == 0 {
+				g.r, g.fakerune = FoldRune, false
+				g.width, _ = fr.Font.GlyphAdvance(FoldRune)
+			}
+
+			fr.glyphs = append(fr.glyphs, g)
+
+			fr.ins.X += g.width
+			prevRune, hasPrev = ' ', true
+			continue
+		}
+
 		switch crune {
 		case '\n':
 			g := glyph{
@@ -322,6 +386,14 @@ func (fr *Frame) Insert(r1, r2 []rune) (limit image.Point) {
 	return
 }
 
+// Returns true if p is inside a fold, fold is the index of the first fold that could contain p and is updated
+func (fr *Frame) inFold(fold *int, p int) bool {
+	for *fold < len(fr.Folds) && fr.Folds[*fold].E <= p {
+		*fold++
+	}
+	return *fold < len(fr.Folds) && fr.Folds[*fold].S <= p
+}
+
 func (fr *Frame) RefreshColors(colors []uint8) {
 	for i := range fr.glyphs {
 		fr.glyphs[i].color = colors[i]
@@ -469,6 +541,8 @@ func (fr *Frame) CoordToPoint(coord image.Point) int {
 	for i, g := range fr.glyphs {
 		if g.p.Y+fm.Descent < ftcoord.Y {
 			continue
+		} else if g.foldedr != 0 && g.width == 0 {
+			continue
 		} else if (g.p.Y - lh) > ftcoord.Y {
 			return i + fr.Top
 		} else if ftcoord.X < g.p.X {
@@ -513,6 +587,7 @@ func (fr *Frame) redrawSelection(s, e int, color *image.Uniform, invalid *[]imag
 		s = 0
 	}
 	fm := fr.Font.Metrics()
+	textR := fr.textR()
 
 	var sp, ep, sep image.Point
 
@@ -537,15 +612,15 @@ func (fr *Frame) redrawSelection(s, e int, color *image.Uniform, invalid *[]imag
 
 	if ss.p.Y == se.p.Y {
 		r := image.Rectangle{sp, ep}
-		r = fr.R.Intersect(r)
+		r = textR.Intersect(r)
 		if invalid != nil {
 			*invalid = append(*invalid, r)
 		}
 		draw.Draw(fr.B, r, color, r.Min, draw.Src)
 	} else {
-		rs := fr.R.Intersect(image.Rectangle{sp, image.Point{fr.rightMargin.Floor(), (ss.p.Y + fm.Descent).Floor()}})
-		re := fr.R.Intersect(image.Rectangle{sep, ep})
-		rb := fr.R.Intersect(image.Rectangle{
+		rs := textR.Intersect(image.Rectangle{sp, image.Point{fr.rightMargin.Floor(), (ss.p.Y + fm.Descent).Floor()}})
+		re := textR.Intersect(image.Rectangle{sep, ep})
+		rb := textR.Intersect(image.Rectangle{
 			image.Point{sep.X, (ss.p.Y + fm.Descent).Floor()},
 			image.Point{fr.rightMargin.Floor(), sep.Y},
 		})
@@ -597,7 +672,7 @@ func (fr *Frame) drawTickOld(idx int) image.Rectangle {
 		g := fr.glyphs[len(fr.glyphs)-1]
 
 		if g.widthy > 0 {
-			x = fr.R.Min.X + fr.margin.Floor()
+			x = fr.leftMargin.Floor()
 			y = (g.p.Y + g.widthy).Floor()
 		} else {
 			x = (g.p.X + g.width).Floor() + 1
@@ -660,7 +735,7 @@ func (fr *Frame) drawTickNew(idx int) image.Rectangle {
 		g := fr.glyphs[len(fr.glyphs)-1]
 
 		if g.widthy > 0 {
-			x = fr.R.Min.X + fr.margin.Floor()
+			x = fr.leftMargin.Floor()
 			y = (g.p.Y + g.widthy).Floor()
 		} else {
 			x = (g.p.X + g.width).Floor() + 1
@@ -721,6 +796,7 @@ func (fr *Frame) updateRedrawOpt() {
 	fr.redrawOpt.drawnVisibleTick = fr.reallyVisibleTick()
 	fr.redrawOpt.drawnSel = fr.Sel
 	fr.redrawOpt.drawnPMatch = fr.PMatch
+	fr.redrawOpt.drawnHighlights = append(fr.redrawOpt.drawnHighlights[:0], fr.Highlights...)
 	fr.redrawOpt.selColor = fr.SelColor
 	fr.redrawOpt.reloaded = false
 	fr.redrawOpt.scrollStart = -1
@@ -811,8 +887,16 @@ func calcPixels(invalid []image.Rectangle) int {
 }
 
 func (fr *Frame) Redraw(flush bool, predrawRects *[]image.Rectangle) {
-	fr.rightMargin = fixed.I(fr.R.Max.X) - fr.margin
-	fr.leftMargin = fixed.I(fr.R.Min.X) + fr.margin
+	fr.setMargins()
+
+	// relative line numbers need to be redrawn when the cursor changes line
+	if fr.Gutter == GUTTER_RELATIVE && fr.cursorLine() != fr.redrawOpt.cursorLine {
+		fr.redrawOpt.reloaded = true
+	}
+
+	if !util.SelsEqual(fr.Highlights, fr.redrawOpt.drawnHighlights) {
+		fr.redrawOpt.reloaded = true
+	}
 
 	// FAST PATH 1
 	// Followed only if:
@@ -837,7 +921,7 @@ func (fr *Frame) Redraw(flush bool, predrawRects *[]image.Rectangle) {
 	// FAST PATH 2
 	// Followed only after a scroll operation and there are no active selections
 	// Bitmaps are copied directly
-	if fr.redrawOpt.scrollStart >= 0 {
+	if fr.redrawOpt.scrollStart >= 0 && fr.Gutter == GUTTER_NONE {
 		if debugRedraw && fr.debugRedraw {
 			fmt.Printf("%p Redrawing (scroll) scrollStart: %d\n", fr, fr.redrawOpt.scrollStart)
 		}
@@ -875,6 +959,9 @@ func (fr *Frame) Redraw(flush bool, predrawRects *[]image.Rectangle) {
 	// background
 	draw.Draw(fr.B, fr.R, &fr.Colors[0][0], fr.R.Min, draw.Src)
 
+	fr.redrawRuler()
+	fr.redrawGutter()
+
 	fr.redrawIntl(fr.glyphs, true, 0)
 
 	// Tick drawing
@@ -889,6 +976,107 @@ func (fr *Frame) Redraw(flush bool, predrawRects *[]image.Rectangle) {
 	}
 }
 
+func (fr *Frame) digitWidth() fixed.Int26_6 {
+	w, _ := fr.Font.GlyphAdvance('0')
+	return w
+}
+
+func (fr *Frame) gutterWidth() fixed.Int26_6 {
+	if fr.Gutter == GUTTER_NONE {
+		return 0
+	}
+	digits := fr.GutterDigits
+	if digits < 3 {
+		digits = 3
+	}
+	return fixed.Int26_6(digits+1) * fr.digitWidth()
+}
+
+// Returns the line number of the cursor, or -1 if the cursor isn't visible
+func (fr *Frame) cursorLine() int {
+	p := fr.Sel.S - fr.Top
+	if p < 0 || p > len(fr.glyphs) {
+		return -1
+	}
+	ln := fr.FirstLine
+	for i := 0; i < p; i++ {
+		if (fr.glyphs[i].fakerune && fr.glyphs[i].r == '\n') || fr.glyphs[i].foldedr == '\n' {
+			ln++
+		}
+	}
+	return ln
+}
+
+func (fr *Frame) redrawGutter() {
+	if fr.Gutter == GUTTER_NONE {
+		return
+	}
+
+	color := &fr.Colors[0][1]
+	if len(fr.Colors[0]) > 2 {
+		color = &fr.Colors[0][2]
+	}
+
+	curln := -1
+	if fr.Gutter == GUTTER_RELATIVE {
+		curln = fr.cursorLine()
+	}
+
+	drawNumber := func(ln int, y fixed.Int26_6) {
+		if y-fr.Font.Metrics().Ascent >= fixed.I(fr.R.Max.Y) {
+			return
+		}
+		n := ln
+		if curln >= 0 && ln != curln {
+			n = abs(ln - curln)
+		}
+		s := strconv.Itoa(n)
+		p := fixed.Point26_6{X: fr.textLeft() - fixed.Int26_6(len(s)+1)*fr.digitWidth(), Y: y}
+		for _, ch := range s {
+			dr, mask, mp, advance, ok := fr.Font.Glyph(p, ch)
+			if ok {
+				dr = fr.R.Intersect(dr)
+				if !dr.Empty() {
+					draw.DrawMask(fr.B, dr, color, dr.Min, mask, mp, draw.Over)
+				}
+			}
+			p.X += advance
+		}
+	}
+
+	if len(fr.glyphs) == 0 {
+		drawNumber(fr.FirstLine, fr.initialInsPoint().Y)
+		return
+	}
+
+	ln := fr.FirstLine
+	drawNumber(ln, fr.glyphs[0].p.Y)
+	for _, g := range fr.glyphs {
+		if g.fakerune && g.r == '\n' {
+			ln++
+			drawNumber(ln, g.p.Y+fr.Font.Metrics().Height)
+		} else if g.foldedr == '\n' {
+			ln++
+		}
+	}
+}
+
+func (fr *Frame) redrawRuler() {
+	if fr.Ruler <= 0 {
+		return
+	}
+
+	color := &fr.Colors[0][1]
+	if len(fr.Colors[0]) > 2 {
+		color = &fr.Colors[0][2]
+	}
+
+	_, _, _, spaceWidth, _ := fr.Font.Glyph(fixed.P(0, 0), ' ')
+	x := (fr.leftMargin + fixed.Int26_6(fr.Ruler)*spaceWidth).Floor()
+	r := fr.R.Intersect(image.Rect(x, fr.R.Min.Y, x+1, fr.R.Max.Y))
+	draw.Draw(fr.B, r, color, r.Min, draw.Src)
+}
+
 func (g *glyph) glyph(face font.Face) (dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
 	r := g.r
 	if g.fakerune {
@@ -899,6 +1087,7 @@ func (g *glyph) glyph(face font.Face) (dr image.Rectangle, mask image.Image, mas
 
 func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 	ssel := 0
+	textR := fr.textR()
 	cury := fixed.I(0)
 	if len(fr.glyphs) > 0 {
 		cury = fr.glyphs[0].p.Y
@@ -914,6 +1103,14 @@ func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 	}
 
 	if drawSels {
+		if len(fr.Colors) > 5 {
+			for _, h := range fr.Highlights {
+				if h.E-fr.Top > n && h.S-fr.Top < n+len(glyphs) {
+					fr.redrawSelection(h.S-fr.Top, h.E-fr.Top, &fr.Colors[5][0], nil)
+				}
+			}
+		}
+
 		if fr.PMatch.S != fr.PMatch.E && len(fr.Colors) > 4 && in(fr.PMatch.S) {
 			fr.redrawSelection(fr.PMatch.S-fr.Top, fr.PMatch.E-fr.Top, &fr.Colors[4][0], nil)
 		}
@@ -923,6 +1120,7 @@ func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 		}
 	}
 
+	hl := 0 // first highlight that could contain the current glyph
 	for i, g := range glyphs {
 		// Selection drawing
 		if ssel != 0 {
@@ -938,6 +1136,11 @@ func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 
 		onpmatch := (fr.PMatch.S != fr.PMatch.E) && (i+fr.Top+n == fr.PMatch.S) && (len(fr.Colors) > 4) && (ssel == 0)
 
+		for hl < len(fr.Highlights) && fr.Highlights[hl].E <= i+fr.Top+n {
+			hl++
+		}
+		onhl := (hl < len(fr.Highlights)) && (fr.Highlights[hl].S <= i+fr.Top+n) && (len(fr.Colors) > 5) && (ssel == 0)
+
 		midlineh := (fr.Font.Metrics().Height - fr.Font.Metrics().Descent).Floor() / 2
 
 		// Softwrap mark drawing
@@ -965,11 +1168,13 @@ func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 
 		// Glyph drawing
 		gr, mask, mp, _, _ := g.glyph(fr.Font)
-		dr := fr.R.Intersect(gr)
+		dr := textR.Intersect(gr)
 		if !dr.Empty() {
 			var color *image.Uniform
 			if onpmatch && len(fr.Colors) > 4 && int(g.color) < len(fr.Colors[4]) {
 				color = &fr.Colors[4][g.color]
+			} else if onhl && int(g.color) < len(fr.Colors[5]) {
+				color = &fr.Colors[5][g.color]
 			} else if ssel >= 0 && ssel < len(fr.Colors) {
 				if g.color >= 0 && int(g.color) < len(fr.Colors[ssel]) {
 					color = &fr.Colors[ssel][g.color]
@@ -987,7 +1192,7 @@ func (fr *Frame) redrawIntl(glyphs []glyph, drawSels bool, n int) {
 func (fr *Frame) drawSingleGlyph(g *glyph, ssel int) {
 	gr, mask, mp, _, _ := g.glyph(fr.Font)
 	// Glyph drawing
-	dr := fr.R.Intersect(gr)
+	dr := fr.textR().Intersect(gr)
 	if !dr.Empty() {
 		//mp := image.Point{dr.Min.X - gr.Min.X, dr.Min.Y - gr.Min.Y}
 		color := &fr.Colors[1][1]
@@ -1059,6 +1264,64 @@ func (f *Frame) OnClick(e util.MouseDownEvent, events <-chan interface{}) *mouse
 	return nil
 }
 
+// Changes Offset so that the character at p is visible, returns true if Offset changed, in which case the frame must be reloaded.
+// Only frames with HF_TRUNCATE set can be scrolled horizontally.
+func (fr *Frame) HScrollTo(p int) bool {
+	if fr.Hackflags&HF_TRUNCATE == 0 {
+		return fr.setOffset(0)
+	}
+
+	pp := p - fr.Top
+	if pp < 0 || pp > len(fr.glyphs) || len(fr.glyphs) == 0 {
+		return false
+	}
+
+	var x fixed.Int26_6
+	if pp < len(fr.glyphs) {
+		x = fr.glyphs[pp].p.X
+	} else if g := fr.glyphs[len(fr.glyphs)-1]; g.fakerune && g.r == '\n' {
+		x = fr.leftMargin
+	} else {
+		x = g.p.X + g.width
+	}
+
+	_, _, _, spaceWidth, _ := fr.Font.Glyph(fixed.P(0, 0), ' ')
+	left := fr.textLeft()
+	slack := (fr.rightMargin - left) / 3
+	off := fixed.I(fr.Offset)
+
+	switch {
+	case x+spaceWidth > fr.rightMargin:
+		off -= x + spaceWidth - fr.rightMargin + slack
+	case x < left:
+		off += left - x + slack
+	default:
+		return false
+	}
+
+	return fr.setOffset(off.Floor())
+}
+
+// Scrolls horizontally by n columns, returns true if Offset changed, in which case the frame must be reloaded.
+func (fr *Frame) HScroll(n int) bool {
+	if fr.Hackflags&HF_TRUNCATE == 0 {
+		return false
+	}
+	_, _, _, spaceWidth, _ := fr.Font.Glyph(fixed.P(0, 0), ' ')
+	return fr.setOffset(fr.Offset - (fixed.Int26_6(n) * spaceWidth).Floor())
+}
+
+func (fr *Frame) setOffset(off int) bool {
+	if off > 0 {
+		off = 0
+	}
+	if off == fr.Offset {
+		return false
+	}
+	fr.Offset = off
+	return true
+}
+
 func (fr *Frame) LineNo() int {
 	return int(float32(fr.R.Max.Y-fr.R.Min.Y) / float32(fr.Font.Metrics().Height.Floor()))
 }
@@ -1233,7 +1496,7 @@ func (fr *Frame) PushDown(ln int, a, b []rune) {
 		draw.Draw(fr.B, r, &fr.Colors[0][0], r.Min, draw.Src)
 	}
 
-	fr.leftMargin = fixed.I(fr.R.Min.X) + fr.margin
+	fr.setMargins()
 	bottom := fixed.I(fr.R.Max.Y) + lh
 
 	if fr.ins.X != fr.leftMargin {
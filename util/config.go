@@ -31,6 +31,52 @@ type LoadRule struct {
 	Action string // action to execute
 }
 
+// SaveHook describes a command executed when a buffer is saved.
+//
+// Concerning Kind:
+// - "fmt" hooks are executed before the buffer is written, the contents
+// of the buffer are written to the standard input of Cmd and replaced
+// with its standard output. If Cmd fails the buffer is saved unchanged.
+// - "lint" hooks are executed after the buffer is written, their output
+// is shown in +Errors
+//
+// The path of the buffer is available to Cmd in the $p environment variable.
+type SaveHook struct {
+	BufRe string // only apply to buffers matching this regular expression
+	Kind  string // fmt or lint
+	Cmd   string // command to execute
+}
+
+// TemplateFile describes a file of templates only used for some buffers.
+//
+// Path is relative to ~/.config/yacco, the file has the same format as
+// ~/.config/yacco/templates
+type TemplateFile struct {
+	BufRe string // only use for buffers matching this regular expression
+	Path  string // file containing the templates
+}
+
+// PlacementRule describes where a new editor is placed.
+//
+// Concerning Column:
+// - "first" and "last" are the first and last column
+// - a number is the n-th column (starting at 1), the last column if there
+// aren't enough columns
+// - "beside <path>" is the column of the editor for <path>, the new editor
+// is placed right below it. Expressions like $1 in <path> are replaced with
+// the corresponding matching group of BufRe, relative paths are relative
+// to the directory of the new editor. If <path> isn't open the rule is
+// ignored.
+//
+// Concerning Position:
+// - "auto" (or empty) uses the same heuristic used for the active column
+// - "top" and "bottom" put the editor above (below) all other editors of the column
+type PlacementRule struct {
+	BufRe    string // only apply to buffers whose path matches this regular expression
+	Column   string // column where the editor is placed
+	Position string // position of the editor inside the column
+}
+
 var keynames = map[key.Code]string{
 	key.CodeReturnEnter:     "return",
 	key.CodeEscape:          "escape",
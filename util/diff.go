@@ -0,0 +1,134 @@
+package util
+
+// A DiffHunk replaces lines [A0, A1) of the old text with lines [B0, B1) of the new text
+type DiffHunk struct {
+	A0, A1 int
+	B0, B1 int
+}
+
+// Maximum number of edits LineDiff will look for before giving up and returning a single hunk
+const maxDiffEdits = 1024
+
+// Returns the list of hunks that transform a into b, in order, using Myers' algorithm
+func LineDiff(a, b []string) []DiffHunk {
+	// strip common prefix and suffix, they are usually most of the text
+	pfx := 0
+	for pfx < len(a) && pfx < len(b) && a[pfx] == b[pfx] {
+		pfx++
+	}
+	sfx := 0
+	for sfx < len(a)-pfx && sfx < len(b)-pfx && a[len(a)-1-sfx] == b[len(b)-1-sfx] {
+		sfx++
+	}
+	a, b = a[pfx:len(a)-sfx], b[pfx:len(b)-sfx]
+
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	hunks, ok := myers(a, b)
+	if !ok {
+		hunks = []DiffHunk{{0, len(a), 0, len(b)}}
+	}
+	for i := range hunks {
+		hunks[i].A0 += pfx
+		hunks[i].A1 += pfx
+		hunks[i].B0 += pfx
+		hunks[i].B1 += pfx
+	}
+	return hunks
+}
+
+func myers(a, b []string) ([]DiffHunk, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxDiffEdits {
+		max = maxDiffEdits
+	}
+	off := max + 1
+	v := make([]int, 2*max+3)
+	trace := [][]int{}
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		// only diagonals -d..d are read back for this step
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// walk back through the trace collecting edits, then coalesce them into hunks
+	type edit struct{ x, y int } // (x, -1) deletes a[x], (-1, y) inserts b[y]
+	edits := []edit{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d] // v[d+k] is the furthest x reached on diagonal k after d-1 edits
+		k := x - y
+		var pk int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := v[d+pk]
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+		}
+		if x > px {
+			edits = append(edits, edit{px, -1})
+		} else {
+			edits = append(edits, edit{-1, py})
+		}
+		x, y = px, py
+	}
+
+	hunks := []DiffHunk{}
+	ax, by := 0, 0 // position in a and b before the current edit
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		var h DiffHunk
+		if e.x >= 0 {
+			// deletion of a[e.x], the corresponding position in b follows from the common lines since the last edit
+			by += e.x - ax
+			ax = e.x
+			h = DiffHunk{ax, ax + 1, by, by}
+			ax++
+		} else {
+			ax += e.y - by
+			by = e.y
+			h = DiffHunk{ax, ax, by, by + 1}
+			by++
+		}
+		if len(hunks) > 0 {
+			last := &hunks[len(hunks)-1]
+			if last.A1 == h.A0 && last.B1 == h.B0 {
+				last.A1 = h.A1
+				last.B1 = h.B1
+				continue
+			}
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks, true
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func applyHunks(a, b []string, hunks []DiffHunk) []string {
+	r := []string{}
+	pos := 0
+	for _, h := range hunks {
+		r = append(r, a[pos:h.A0]...)
+		r = append(r, b[h.B0:h.B1]...)
+		pos = h.A1
+	}
+	return append(r, a[pos:]...)
+}
+
+func testLineDiff(t *testing.T, a, b string, nhunks int) {
+	t.Helper()
+	av, bv := strings.Split(a, "\n"), strings.Split(b, "\n")
+	hunks := LineDiff(av, bv)
+	if r := strings.Join(applyHunks(av, bv, hunks), "\n"); r != b {
+		t.Errorf("diff of %q %q: hunks %v produce %q", a, b, hunks, r)
+	}
+	if nhunks >= 0 && len(hunks) != nhunks {
+		t.Errorf("diff of %q %q: expected %d hunks got %v", a, b, nhunks, hunks)
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	testLineDiff(t, "a\nb\nc", "a\nb\nc", 0)
+	testLineDiff(t, "a\nb\nc", "a\nx\nc", 1)
+	testLineDiff(t, "a\nb\nc", "a\nc", 1)
+	testLineDiff(t, "a\nc", "a\nb\nc", 1)
+	testLineDiff(t, "", "a\nb", 1)
+	testLineDiff(t, "a\nb", "", 1)
+	testLineDiff(t, "a\nb\nc\nd\ne", "x\nb\nc\nd\ny", 2)
+	testLineDiff(t, "a\nb\nc\nd\ne\nf", "a\nc\nb\nd\nf\ne", -1)
+	testLineDiff(t, "func f() {\nx:=1\n}\n", "func f() {\n\tx := 1\n}\n", 1)
+
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d"}
+	randText := func() string {
+		v := make([]string, rnd.Intn(20))
+		for i := range v {
+			v[i] = words[rnd.Intn(len(words))]
+		}
+		return strings.Join(v, "\n")
+	}
+	for i := 0; i < 500; i++ {
+		testLineDiff(t, randText(), randText(), -1)
+	}
+}
@@ -52,16 +52,10 @@ func fmteventEx(eventChan chan string, origin EventOrigin, istag bool, etype Eve
 			fmt.Fprintf(os.Stderr, "fmteventEx: %v\n", ierr)
 		}
 	}()
-	if istag {
-		etype = EventType(unicode.ToLower(rune(etype)))
-	}
-	if utf8.RuneCountInString(arg) >= MAX_EVENT_TEXT_LENGTH {
-		arg = ""
-	}
 	t := time.NewTimer(100 * time.Millisecond)
 	defer t.Stop()
 	select {
-	case eventChan <- fmt.Sprintf("%c%c%d %d %d %d %s\n", origin, etype, s, e, flags, utf8.RuneCountInString(arg), arg):
+	case eventChan <- FormatEvent(origin, istag, etype, s, e, flags, arg):
 		return true
 	case <-t.C:
 		onfail()
@@ -69,6 +63,17 @@ func fmteventEx(eventChan chan string, origin EventOrigin, istag bool, etype Eve
 	}
 }
 
+// Formats an event message as it is written to the event file
+func FormatEvent(origin EventOrigin, istag bool, etype EventType, s, e int, flags EventFlag, arg string) string {
+	if istag {
+		etype = EventType(unicode.ToLower(rune(etype)))
+	}
+	if utf8.RuneCountInString(arg) >= MAX_EVENT_TEXT_LENGTH {
+		arg = ""
+	}
+	return fmt.Sprintf("%c%c%d %d %d %d %s\n", origin, etype, s, e, flags, utf8.RuneCountInString(arg), arg)
+}
+
 func FmteventBase(eventChan chan string, origin EventOrigin, istag bool, etype EventType, s, e int, arg string, onfail func()) {
 	fmteventEx(eventChan, origin, istag, etype, s, e, 0, arg, onfail)
 }
@@ -18,8 +18,9 @@ type AltingEntry struct {
 }
 
 type WheelEvent struct {
-	Where image.Point
-	Count int
+	Where      image.Point
+	Count      int
+	Horizontal bool
 }
 
 type MouseDownEvent struct {
@@ -111,9 +112,13 @@ func (em *eventMachine) processEvent(ei interface{}, altingList []AltingEntry, k
 			where := image.Point{int(e.X), int(e.Y)}
 			switch e.Button {
 			case mouse.ButtonWheelUp:
-				em.appendWheelEvent(where, -1)
+				em.appendWheelEvent(where, -1, false)
 			case mouse.ButtonWheelDown:
-				em.appendWheelEvent(where, +1)
+				em.appendWheelEvent(where, +1, false)
+			case mouse.ButtonWheelLeft:
+				em.appendWheelEvent(where, -1, true)
+			case mouse.ButtonWheelRight:
+				em.appendWheelEvent(where, +1, true)
 			}
 
 		case mouse.DirPress:
@@ -272,16 +277,19 @@ func (em *eventMachine) appendMouseMovedEvent(e mouse.Event) {
 	em.appendEventOther(ET_MOUSE_MOVE, e)
 }
 
-func (em *eventMachine) appendWheelEvent(w image.Point, d int) {
+func (em *eventMachine) appendWheelEvent(w image.Point, d int, horizontal bool) {
 	for i := range em.events {
 		if em.events[i].et == ET_WHEEL {
 			e := em.events[i].ei.(WheelEvent)
+			if e.Horizontal != horizontal {
+				continue
+			}
 			e.Count += d
 			em.removeAndReaddEvent(i, e, ET_WHEEL)
 			return
 		}
 	}
-	em.appendEventOther(ET_WHEEL, WheelEvent{Count: d, Where: w})
+	em.appendEventOther(ET_WHEEL, WheelEvent{Count: d, Where: w, Horizontal: horizontal})
 }
 
 func (em *eventMachine) appendResizeEvent(e size.Event) {
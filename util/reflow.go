@@ -0,0 +1,128 @@
+package util
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Splits the indentation and comment characters at the beginning of text from the rest of the line
+func CommentPrefix(text string) (prefix, rest string) {
+	i := 0
+	for i < len(text) {
+		if text[i] != ' ' && text[i] != '\t' {
+			break
+		}
+		i++
+	}
+
+	if i >= len(text) {
+		return text, ""
+	}
+
+	var commentChar byte
+
+	if ch := text[i]; ch == '/' || ch == '#' || ch == ';' || ch == '%' {
+		commentChar = ch
+	} else {
+		return text[:i], text[i:]
+	}
+
+	for i < len(text) {
+		if text[i] != commentChar {
+			break
+		}
+		i++
+	}
+
+	if i < len(text) && text[i] == ' ' {
+		i++
+	}
+
+	return text[:i], text[i:]
+}
+
+// Splits text into lines no longer than n characters, assuming each of them will be preceded by a prefix prefixlen characters long
+func SplitText(text string, prefixlen, n int) []string {
+	b := []byte(text)
+	lastSpace := -1
+	lineStart := 0
+	for i := 0; i < len(b); i++ {
+		if b[i] == ' ' || b[i] == '\t' {
+			lastSpace = i
+		}
+		if (i-lineStart)+prefixlen > n && lastSpace >= 0 {
+			b[lastSpace] = '\n'
+			lineStart = lastSpace + 1
+			lastSpace = -1
+		}
+	}
+	return strings.Split(string(b), "\n")
+}
+
+// Returns the bullet of a markdown list item (including the space after it) or the empty string
+func listBullet(text string) string {
+	if len(text) >= 2 && (text[0] == '-' || text[0] == '*' || text[0] == '+') && text[1] == ' ' {
+		return text[:2]
+	}
+	i := 0
+	for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(text) && (text[i] == '.' || text[i] == ')') && text[i+1] == ' ' {
+		return text[:i+2]
+	}
+	return ""
+}
+
+// Rewraps paragraphs of text to the specified width.
+// Paragraphs are separated by empty lines, by changes in indentation or comment prefix and by markdown list items, the prefix of each paragraph is preserved.
+func Reflow(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+
+	var prefix, contPrefix string
+	para := []string{}
+
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		cur := prefix
+		empty := true
+		for _, word := range strings.Fields(strings.Join(para, " ")) {
+			if !empty && utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) > width {
+				out = append(out, cur)
+				cur = contPrefix
+				empty = true
+			}
+			if !empty {
+				cur += " "
+			}
+			cur += word
+			empty = false
+		}
+		out = append(out, cur)
+		para = para[:0]
+	}
+
+	for _, line := range lines {
+		p, rest := CommentPrefix(line)
+		if strings.TrimSpace(rest) == "" {
+			flush()
+			out = append(out, line)
+			continue
+		}
+		bullet := listBullet(rest)
+		if len(para) > 0 && bullet == "" && p == contPrefix {
+			para = append(para, rest)
+			continue
+		}
+		flush()
+		prefix = p
+		contPrefix = p + strings.Repeat(" ", len(bullet))
+		para = append(para, rest)
+	}
+	flush()
+
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"testing"
+)
+
+func reflowIs(t *testing.T, in string, width int, tgt string) {
+	out := Reflow(in, width)
+	if out != tgt {
+		t.Fatalf("Reflow of <%s> failed:\ntgt: <%s>\nout: <%s>\n", in, tgt, out)
+	}
+}
+
+func TestReflow(t *testing.T) {
+	reflowIs(t, "a b c d e f\n", 5, "a b c\nd e f\n")
+	reflowIs(t, "a b\nc d e f\n\ng h\n", 7, "a b c d\ne f\n\ng h\n")
+	reflowIs(t, "\t// aaa bbb\n\t// ccc\n\t//\n\t// ddd\n", 14, "\t// aaa bbb\n\t// ccc\n\t//\n\t// ddd\n")
+	reflowIs(t, "\t// aaa bbb\n\t// ccc\n", 20, "\t// aaa bbb ccc\n")
+	reflowIs(t, "# aaa bbb ccc ddd\n", 12, "# aaa bbb\n# ccc ddd\n")
+	reflowIs(t, "- aaa bbb\n- ccc ddd eee\n  fff\n", 11, "- aaa bbb\n- ccc ddd\n  eee fff\n")
+	reflowIs(t, "1. aaa bbb ccc\n2) ddd\n", 10, "1. aaa bbb\n   ccc\n2) ddd\n")
+}
+
+func TestCommentPrefix(t *testing.T) {
+	for _, tc := range []struct{ in, prefix, rest string }{
+		{"\t// comment", "\t// ", "comment"},
+		{"  ## comment", "  ## ", "comment"},
+		{"  text", "  ", "text"},
+		{"   ", "   ", ""},
+		{"", "", ""},
+	} {
+		prefix, rest := CommentPrefix(tc.in)
+		if prefix != tc.prefix || rest != tc.rest {
+			t.Fatalf("CommentPrefix(%q) = %q, %q (expected %q, %q)", tc.in, prefix, rest, tc.prefix, tc.rest)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// A Template is inserted by the Template command and by completion, only templates marked as snippets are expanded with ExpandSnippet
+type Template struct {
+	Text    string
+	Snippet bool
+}
+
+// Expands the template, every newline of the template is followed by indent.
+// Only snippets have tab stops and variables, the text of other templates is used as is.
+func (t Template) Expand(indent string, vars map[string]string) (string, []SnippetStop) {
+	if t.Snippet {
+		return ExpandSnippet(t.Text, indent, vars)
+	}
+	return strings.Replace(t.Text, "\n", "\n"+indent, -1), []SnippetStop{}
+}
+
+// A SnippetStop is a tab stop in the text of an expanded snippet, S and E are rune offsets of its default value
+type SnippetStop struct {
+	N    int
+	S, E int
+}
+
+type snippetToken struct {
+	lit  string
+	stop int // -1 for literal text
+}
+
+// Expands a snippet template.
+// Inside the template:
+// - $N and ${N} are tab stops, ${N:text} is a tab stop with default value text, stops with the same N mirror each other
+// - $0 is the position of the cursor after the last tab stop
+// - $NAME and ${NAME} are replaced by the value of vars[NAME], names that aren't in vars are left untouched
+// - $$ is a literal $
+// Every newline of the template is followed by indent.
+// Returns the expanded text and the position of all tab stops, in the order they appear.
+func ExpandSnippet(tmpl, indent string, vars map[string]string) (string, []SnippetStop) {
+	toks, defaults := parseSnippet(tmpl, vars)
+
+	out := []rune{}
+	emit := func(s string) {
+		for _, r := range s {
+			out = append(out, r)
+			if r == '\n' {
+				out = append(out, []rune(indent)...)
+			}
+		}
+	}
+
+	stops := []SnippetStop{}
+	for _, tok := range toks {
+		if tok.stop < 0 {
+			emit(tok.lit)
+			continue
+		}
+		s := len(out)
+		emit(defaults[tok.stop])
+		stops = append(stops, SnippetStop{tok.stop, s, len(out)})
+	}
+	return string(out), stops
+}
+
+func parseSnippet(tmpl string, vars map[string]string) ([]snippetToken, map[int]string) {
+	toks := []snippetToken{}
+	defaults := map[int]string{}
+	lit := []rune{}
+	flush := func() {
+		if len(lit) > 0 {
+			toks = append(toks, snippetToken{string(lit), -1})
+			lit = lit[:0]
+		}
+	}
+	stop := func(name, def string) bool {
+		n, err := strconv.Atoi(name)
+		if err != nil || n < 0 {
+			return false
+		}
+		flush()
+		if defaults[n] == "" {
+			// the first default value specified for a stop is used by all its mirrors
+			defaults[n] = def
+		}
+		toks = append(toks, snippetToken{"", n})
+		return true
+	}
+
+	rs := []rune(tmpl)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '$' || i+1 >= len(rs) {
+			lit = append(lit, rs[i])
+			continue
+		}
+		switch c := rs[i+1]; {
+		case c == '$':
+			lit = append(lit, '$')
+			i++
+
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(rs) && rs[j] >= '0' && rs[j] <= '9' {
+				j++
+			}
+			stop(string(rs[i+1:j]), "")
+			i = j - 1
+
+		case c == '{':
+			j := i + 2
+			for j < len(rs) && rs[j] != '}' {
+				j++
+			}
+			if j >= len(rs) {
+				lit = append(lit, '$')
+				continue
+			}
+			inner := string(rs[i+2 : j])
+			name, def, hasdef := inner, "", false
+			if k := strings.Index(inner, ":"); k >= 0 {
+				name, def, hasdef = inner[:k], inner[k+1:], true
+			}
+			if stop(name, def) {
+				i = j
+			} else if v, ok := vars[name]; ok && !hasdef {
+				lit = append(lit, []rune(v)...)
+				i = j
+			} else {
+				lit = append(lit, '$')
+			}
+
+		case c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(rs) && ((rs[j] >= 'A' && rs[j] <= 'Z') || rs[j] == '_') {
+				j++
+			}
+			if v, ok := vars[string(rs[i+1:j])]; ok {
+				lit = append(lit, []rune(v)...)
+				i = j - 1
+			} else {
+				lit = append(lit, '$')
+			}
+
+		default:
+			lit = append(lit, '$')
+		}
+	}
+	flush()
+	return toks, defaults
+}
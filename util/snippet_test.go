@@ -0,0 +1,49 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandSnippet(t *testing.T) {
+	vars := map[string]string{"FILENAME": "a.go", "SELECTION": "x"}
+	tests := []struct {
+		tmpl, indent string
+		out          string
+		stops        []SnippetStop
+	}{
+		{"plain", "", "plain", []SnippetStop{}},
+		{"for $1 {\n\t$0\n}", "\t", "for  {\n\t\t\n\t}", []SnippetStop{{1, 4, 4}, {0, 9, 9}}},
+		{"${1:i} := 0; $1 < ${2:n}; $1++", "", "i := 0; i < n; i++", []SnippetStop{{1, 0, 1}, {1, 8, 9}, {2, 12, 13}, {1, 15, 16}}},
+		{"$1 = ${1:def}", "", "def = def", []SnippetStop{{1, 0, 3}, {1, 6, 9}}},
+		{"// $FILENAME: ${SELECTION}$HOME", "", "// a.go: x$HOME", []SnippetStop{}},
+		{"$$1 ${2} $", "", "$1  $", []SnippetStop{{2, 3, 3}}},
+		{"${unterminated", "", "${unterminated", []SnippetStop{}},
+		{"${FILENAME:x}", "", "${FILENAME:x}", []SnippetStop{}},
+		{"è${1:à}", "", "èà", []SnippetStop{{1, 1, 2}}},
+	}
+	for _, tc := range tests {
+		out, stops := ExpandSnippet(tc.tmpl, tc.indent, vars)
+		if out != tc.out || !reflect.DeepEqual(stops, tc.stops) {
+			t.Errorf("ExpandSnippet(%q): got %q %v expected %q %v", tc.tmpl, out, stops, tc.out, tc.stops)
+		}
+	}
+}
+
+func TestTemplateExpand(t *testing.T) {
+	vars := map[string]string{"FILENAME": "a.go"}
+	tests := []struct {
+		tmpl  Template
+		out   string
+		stops []SnippetStop
+	}{
+		{Template{"cost: $1 ${2:x} $FILENAME\n", false}, "cost: $1 ${2:x} $FILENAME\n\t", []SnippetStop{}},
+		{Template{"cost: $1 ${2:x} $FILENAME\n", true}, "cost:  x a.go\n\t", []SnippetStop{{1, 6, 6}, {2, 7, 8}}},
+	}
+	for _, tc := range tests {
+		out, stops := tc.tmpl.Expand("\t", vars)
+		if out != tc.out || !reflect.DeepEqual(stops, tc.stops) {
+			t.Errorf("Expand(%v): got %q %v expected %q %v", tc.tmpl, out, stops, tc.out, tc.stops)
+		}
+	}
+}
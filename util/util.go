@@ -23,6 +23,19 @@ type Sel struct {
 	S, E int
 }
 
+// Returns true if a and b contain the same selections in the same order
+func SelsEqual(a, b []Sel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func Must(err error, msg string) {
 	if err != nil {
 		panic(fmt.Sprintf("%s: %v", msg, err))
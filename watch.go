@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+
+	"github.com/aarzilli/yacco/buf"
+	"github.com/aarzilli/yacco/util"
+)
+
+/*
+The watch files broadcast insertions, deletions and executions to any number of readers, unlike the event file they can not be used to intercept events.
+Each buffer has its own watch file, messages are in the same format as the event file. The global watch file prefixes each message with the id of the buffer.
+*/
+
+// number of messages a reader of a watch file can fall behind before it is disconnected
+const watchBacklog = 256
+
+const watchGlobal = -1
+
+var watchMu sync.Mutex
+
+// subscribers to watch files, indexed by buffer id (watchGlobal for the global watch file) and connection
+var watchChans = map[int]map[string]chan string{}
+
+func openWatchFn(i int, conn string) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if watchChans[i] == nil {
+		watchChans[i] = map[string]chan string{}
+	}
+	watchChans[i][conn] = make(chan string, watchBacklog)
+	return nil
+}
+
+func readWatchFn(i int, conn string) ([]byte, syscall.Errno) {
+	watchMu.Lock()
+	ch, ok := watchChans[i][conn]
+	watchMu.Unlock()
+	if !ok {
+		return []byte{}, 0
+	}
+
+	msg, ok := <-ch
+	if !ok {
+		return []byte{}, 0
+	}
+	return []byte(msg), 0
+}
+
+func clunkWatchFn(i int, conn string) error {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if ch, ok := watchChans[i][conn]; ok {
+		close(ch)
+		delete(watchChans[i], conn)
+	}
+	return nil
+}
+
+// Disconnects all readers of the watch file of buffer i
+func watchRemove(i int) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	for _, ch := range watchChans[i] {
+		close(ch)
+	}
+	delete(watchChans, i)
+}
+
+func watchActive() bool {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	for _, m := range watchChans {
+		if len(m) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends msg to all readers of the watch file of buffer i and of the global watch file, readers that are too slow are disconnected
+func watchSend(i int, msg string) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	send := func(k int, msg string) {
+		for conn, ch := range watchChans[k] {
+			select {
+			case ch <- msg:
+			default:
+				close(ch)
+				delete(watchChans[k], conn)
+			}
+		}
+	}
+	send(i, msg)
+	send(watchGlobal, fmt.Sprintf("%d %s", i, msg))
+}
+
+func watchBufferEvent(b *buf.Buffer, origin util.EventOrigin, etype util.EventType, s, e int, text string) {
+	if !watchActive() || Wnd.cols == nil {
+		return
+	}
+	for _, col := range Wnd.cols.cols {
+		for _, ed := range col.editors {
+			switch b {
+			case ed.bodybuf:
+				watchSend(ed.edid, util.FormatEvent(origin, false, etype, s, e, 0, text))
+			case ed.tagbuf:
+				watchSend(ed.edid, util.FormatEvent(origin, true, etype, s, e, 0, text))
+			}
+		}
+	}
+}
+
+func watchExec(ec ExecContext, cmd string) {
+	if ec.ed == nil || !watchActive() {
+		return
+	}
+	istag := ec.fr == &ec.ed.tagfr
+	s, e := 0, 0
+	if ec.fr != nil {
+		s, e = ec.fr.Sel.S, ec.fr.Sel.E
+	}
+	watchSend(ec.ed.edid, util.FormatEvent(util.EO_MOUSE, istag, util.ET_BODYEXEC, s, e, 0, cmd))
+}
@@ -116,6 +116,7 @@ func (w *Window) Init(s screen.Screen, width, height int) (err error) {
 	w.Prop["indentchar"] = "\t"
 	w.Prop["font"] = "main"
 	w.Prop["lookexact"] = "no"
+	w.Prop["hlword"] = "no"
 	w.Words = []string{}
 
 	w.screen = s
@@ -329,6 +330,12 @@ func (w *Window) EventLoop() {
 			se()
 		}
 
+		jsonLogLayout()
+		syncDiffViews()
+		syncScrollLocks()
+		syncSnippets()
+		syncHighlights()
+
 		// update completions dictionary at least once every 10 minutes
 		if time.Now().Sub(lastWordUpdate) >= time.Duration(10*time.Minute) {
 			lastWordUpdate = time.Now()
@@ -440,14 +447,17 @@ func (w *Window) UiEventLoop(ei interface{}, events chan interface{}) {
 					w.ColResize(lp.col, e, events)
 				}
 			}
-			activeEditor = nil
-			activeCol = lp.col
+			setActive(nil, lp.col)
 		}
 
 	case util.WheelEvent:
 		HideCompl(true)
 		lp := w.TranslatePosition(e.Where, false)
-		if lp.sfr != nil {
+		if e.Horizontal {
+			if lp.sfr != nil && lp.ed != nil {
+				lp.ed.HScroll(4 * e.Count)
+			}
+		} else if lp.sfr != nil {
 			if e.Count > 0 {
 				lp.sfr.Fr.Scroll(+1, 2*e.Count)
 			} else {
@@ -753,12 +763,25 @@ func shrinkEditor(ed *Editor, max int) int {
 }
 
 func (w *Window) GrowEditor(col *Col, ed *Editor, d *image.Point) {
+	if col.stacked {
+		col.stackShow(ed)
+		return
+	}
+
 	mh := ed.MinHeight()
 	want := ed.size / 2
 	if want < mh*3 {
 		want = mh * 3
 	}
 
+	w.growEditorBy(col, ed, want)
+	if d != nil {
+		ed.WarpToHandle()
+	}
+}
+
+// Grows ed by up to want pixels taking space from the nearest editors
+func (w *Window) growEditorBy(col *Col, ed *Editor, want int) {
 	idx := col.IndexOf(ed)
 	for off := 1; off < len(col.editors); off++ {
 		i := idx + off
@@ -783,9 +806,6 @@ func (w *Window) GrowEditor(col *Col, ed *Editor, d *image.Point) {
 	col.RecalcRects(col.last)
 	col.Redraw()
 	w.FlushImage(col.r)
-	if d != nil {
-		ed.WarpToHandle()
-	}
 }
 
 func (w *Window) ColResize(col *Col, e util.MouseDownEvent, events <-chan interface{}) {
@@ -1018,10 +1038,18 @@ func (w *Window) Type(lp LogicalPos, e key.Event) {
 		ec := lp.asExecContext(true)
 		if ec.buf != nil {
 			switch {
+			case Compl.Visible && complSnippet != nil:
+				HideCompl(false)
+				_, _, templwd, templind := getComplWords(ec)
+				insertSnippet(ec, util.Sel{ec.fr.Sel.S - len([]rune(templwd)), ec.fr.Sel.S}, *complSnippet, templind, "")
+				ec.br()
 			case Compl.Visible:
 				ec.buf.Replace([]rune(complPrefixSuffix), &ec.fr.Sel, true, ec.eventChan, util.EO_KBD)
 				ec.br()
 				Compl.Start(ec)
+			case snippetActive(ec.ed) && ec.buf == ec.ed.bodybuf:
+				snippetNext()
+				ec.br()
 			default:
 				HideCompl(false)
 				tch := "\t"
@@ -1066,8 +1094,7 @@ func (w *Window) Type(lp LogicalPos, e key.Event) {
 		} else if e.Rune > 0 {
 			LastTypeTime = time.Now()
 			if lp.tagfr == nil && ec.ed != nil {
-				activeEditor = ec.ed
-				activeCol = nil
+				setActive(ec.ed, nil)
 			}
 			if ec.buf != nil {
 				ec.buf.Replace([]rune{e.Rune}, &ec.fr.Sel, true, ec.eventChan, util.EO_KBD)
@@ -1179,8 +1206,7 @@ func clickExec1(lp LogicalPos, e util.MouseDownEvent) {
 	if lp.sfr != nil {
 		lp.sfr.Fr.SelColor = 0
 		activeSel.Set(lp)
-		activeEditor = lp.ed
-		activeCol = nil
+		setActive(lp.ed, nil)
 		lp.bufferRefreshable(false)()
 	}
 	if lp.tagfr != nil {
@@ -1192,6 +1218,9 @@ func clickExec1(lp LogicalPos, e util.MouseDownEvent) {
 // Simple execute without extra arguments
 func clickExec2(lp LogicalPos) {
 	cmd, original := expandedSelection(lp, 1)
+	if stackTabClick(lp, original) {
+		return
+	}
 	ec := lp.asExecContext(false)
 	sendEventOrExec(ec, cmd, lp.tagfr != nil, original)
 }
@@ -1231,6 +1260,9 @@ func clickExec2extra(lp LogicalPos) {
 func clickExec3(lp LogicalPos) {
 	ec := lp.asExecContext(true)
 	s, original := expandedSelection(lp, 2)
+	if stackTabClick(lp, original) {
+		return
+	}
 
 	if (lp.ed == nil) || (lp.ed.eventChan == nil) || lp.ed.eventChanSpecial {
 		lastLoadSel.Set2(lp, original)
@@ -1270,6 +1302,23 @@ eventLoop:
 	CopyCmd(lp.asExecContext(true), "", del)
 }
 
+// Shows the editor whose tab was clicked in the tag of a stacked column, p is the position of the click (-1 to use the selection)
+func stackTabClick(lp LogicalPos, p int) bool {
+	if lp.col == nil || lp.ed != nil || lp.tagfr != &lp.col.tagfr || !lp.col.stacked {
+		return false
+	}
+	if p < 0 {
+		p = lp.tagfr.Sel.S
+	}
+	ed := lp.col.tabAt(p)
+	if ed == nil {
+		return false
+	}
+	lp.col.stackShow(ed)
+	setActive(ed, nil)
+	return true
+}
+
 func expandedSelection(lp LogicalPos, idx int) (string, int) {
 	original := -1
 
@@ -1463,7 +1512,7 @@ func (w *Window) Dump() DumpWindow {
 	return DumpWindow{cols, bufs, w.tagbuf.Dir, string(w.tagbuf.SelectionRunes(util.Sel{w.tagbuf.EditableStart, w.tagbuf.Size()}))}
 }
 
-func ReplaceMsg(ec *ExecContext, esel *util.Sel, append bool, txt string, origin util.EventOrigin, reselect bool, scroll bool) func() {
+func ReplaceMsg(ec *ExecContext, esel *util.Sel, append bool, txt string, origin util.EventOrigin, reselect bool, scroll bool, minimal bool) func() {
 	return func() {
 		found := false
 	bufsearch:
@@ -1488,7 +1537,11 @@ func ReplaceMsg(ec *ExecContext, esel *util.Sel, append bool, txt string, origin
 			}
 		}
 		oldS := sel.S
-		ec.ed.bodybuf.Replace([]rune(txt), sel, true, ec.eventChan, origin)
+		if minimal {
+			ec.ed.bodybuf.ReplaceMinimal([]rune(txt), sel, true, ec.eventChan, origin)
+		} else {
+			ec.ed.bodybuf.Replace([]rune(txt), sel, true, ec.eventChan, origin)
+		}
 		if reselect {
 			sel.S = oldS
 		}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+/*
+Commands to arrange editors and columns from the keyboard, they act on the editor where they are executed or, from the tag of a column, on the active editor.
+*/
+
+// number of lines Grow and Shrink use when called without arguments
+const growDefaultLines = 5
+
+func wmEditor(ec ExecContext) *Editor {
+	if ec.ed != nil {
+		return ec.ed
+	}
+	return activeEditor
+}
+
+// Makes ed the active editor and moves the mouse (and thus the keyboard focus) to it
+func focusEditor(ed *Editor) {
+	setActive(ed, nil)
+	ed.Warp()
+}
+
+// Moves the focus to the editor left, right, above or below the current one
+func FocusCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := wmEditor(ec)
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil {
+		return
+	}
+
+	switch arg = strings.TrimSpace(arg); arg {
+	case "up", "down":
+		i := col.IndexOf(ed)
+		if arg == "up" {
+			i--
+		} else {
+			i++
+		}
+		if i < 0 || i >= len(col.editors) {
+			return
+		}
+		focusEditor(col.editors[i])
+
+	case "left", "right":
+		i := Wnd.cols.IndexOf(col)
+		if arg == "left" {
+			i--
+		} else {
+			i++
+		}
+		if i < 0 || i >= len(Wnd.cols.cols) {
+			return
+		}
+		if other := editorAtHeight(Wnd.cols.cols[i], ed.sfr.Fr.PointToCoord(ed.sfr.Fr.Sel.S).Y); other != nil {
+			focusEditor(other)
+		}
+
+	default:
+		Warn("Focus: unknown direction " + arg)
+	}
+}
+
+// Returns the editor of col at height y, or the closest one
+func editorAtHeight(col *Col, y int) *Editor {
+	if col.stacked {
+		return col.stackCurrent()
+	}
+	var r *Editor
+	for _, ed := range col.editors {
+		if ed.r.Min.Y > y && r != nil {
+			break
+		}
+		r = ed
+	}
+	return r
+}
+
+// Moves the current editor to the next (or previous) column
+func MovecolCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := wmEditor(ec)
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil {
+		return
+	}
+
+	i := Wnd.cols.IndexOf(col)
+	switch strings.TrimSpace(arg) {
+	case "next":
+		i++
+	case "prev":
+		i--
+	default:
+		Warn("Movecol: argument must be next or prev")
+		return
+	}
+	if i < 0 || i >= len(Wnd.cols.cols) {
+		return
+	}
+
+	col.Remove(col.IndexOf(ed))
+	heuristicAddEditor(Wnd.cols.cols[i], ed)
+	Wnd.FlushImage()
+	focusEditor(ed)
+}
+
+func linesArg(arg string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+	if err != nil || n <= 0 {
+		return growDefaultLines
+	}
+	return n
+}
+
+// Makes the current editor taller by taking space from the others
+func GrowCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := wmEditor(ec)
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil || col.stacked {
+		return
+	}
+	col.maximized = nil
+	Wnd.growEditorBy(col, ed, linesArg(arg)*TagHeight(&ed.tagfr))
+}
+
+// Makes the current editor shorter, giving the space to the editor below it (or above it, if it is the last one)
+func ShrinkCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := wmEditor(ec)
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil || col.stacked || len(col.editors) < 2 {
+		return
+	}
+	col.maximized = nil
+
+	s := linesArg(arg) * TagHeight(&ed.tagfr)
+	if mh := ed.MinHeight(); ed.size-s < mh {
+		s = ed.size - mh
+	}
+	if s <= 0 {
+		return
+	}
+	i := col.IndexOf(ed) + 1
+	if i >= len(col.editors) {
+		i -= 2
+	}
+	ed.size -= s
+	col.editors[i].size += s
+
+	col.RecalcRects(col.last)
+	col.Redraw()
+	Wnd.FlushImage(col.r)
+}
+
+// Gives the current editor all the height of its column, leaving only the tags of the others visible, executed again restores the previous sizes
+func MaximizeCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+	ed := wmEditor(ec)
+	if ed == nil {
+		return
+	}
+	col := ed.Column()
+	if col == nil || col.stacked {
+		return
+	}
+
+	if col.maximized == ed {
+		for _, ced := range col.editors {
+			if sz, ok := col.unmaximizedSize[ced]; ok {
+				ced.size = sz
+			}
+		}
+		col.maximized = nil
+	} else {
+		col.unmaximizedSize = map[*Editor]int{}
+		for _, ced := range col.editors {
+			col.unmaximizedSize[ced] = ced.size
+		}
+		ed.size = col.contentArea()
+		for _, ced := range col.editors {
+			if ced == ed {
+				continue
+			}
+			ced.size = ced.MinHeight()
+			ed.size -= ced.size
+		}
+		col.maximized = ed
+	}
+
+	col.RecalcRects(col.last)
+	col.Redraw()
+	Wnd.FlushImage(col.r)
+	ed.Warp()
+}
+
+// Gives the same height to all editors of the current column, or with 'cols' the same width to all columns
+func EqualizeCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	if strings.TrimSpace(arg) == "cols" {
+		for _, col := range Wnd.cols.cols {
+			col.frac = 10.0 / float64(len(Wnd.cols.cols))
+		}
+		Wnd.cols.RecalcRects()
+		Wnd.RedrawHard()
+		return
+	}
+
+	col := ec.col
+	if col == nil {
+		if ed := wmEditor(ec); ed != nil {
+			col = ed.Column()
+		}
+	}
+	if col == nil || col.stacked {
+		return
+	}
+	col.maximized = nil
+	col.equalizeEditors()
+	col.RecalcRects(col.last)
+	col.Redraw()
+	Wnd.FlushImage(col.r)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aarzilli/yacco/config"
+	"github.com/aarzilli/yacco/util"
+)
+
+const workspaceExt = ".dump"
+
+// name of the workspace we were asked to switch to while there were unsaved buffers
+var workspaceConfirmed string
+
+func workspacesDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".config", "yacco", "workspaces")
+}
+
+func workspacePath(name string) string {
+	return filepath.Join(workspacesDir(), name+workspaceExt)
+}
+
+// Returns the root of the git repository containing dir, or dir itself if it isn't inside a git repository
+func projectRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// Returns the name of the workspace of the project at root, the hash of the full path keeps projects with the same directory name apart
+func defaultWorkspaceName(root string) string {
+	h := sha1.Sum([]byte(root))
+	return fmt.Sprintf("%s-%x", filepath.Base(root), h[:4])
+}
+
+func WorkspaceCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	wd, _ := os.Getwd()
+	root := projectRoot(wd)
+
+	name := defaultWorkspaceName(root)
+	if v := strings.Fields(arg); len(v) > 0 {
+		name = v[0]
+	}
+	if strings.Contains(name, "/") {
+		Warn("Workspace: invalid workspace name " + name)
+		return
+	}
+
+	dest := workspacePath(name)
+	if dest == AutoDumpPath {
+		return
+	}
+
+	if workspaceConfirmed != name {
+		t := "Workspace: the following files have unsaved changes (execute again to switch anyway):\n"
+		n := 0
+		for _, col := range Wnd.cols.cols {
+			for _, ed := range col.editors {
+				if ed.bodybuf.Modified && !fakebuf(ed.bodybuf.Name) {
+					t += ed.bodybuf.ShortName() + "\n"
+					n++
+				}
+			}
+		}
+		if n > 0 {
+			workspaceConfirmed = name
+			Warn(t)
+			return
+		}
+	}
+	workspaceConfirmed = ""
+
+	if AutoDumpPath != "" {
+		DumpTo(AutoDumpPath)
+	}
+
+	if _, err := os.Stat(dest); err == nil {
+		if !LoadFrom(dest) {
+			return
+		}
+	} else {
+		restoreDump(&DumpWindow{
+			Columns: []DumpColumn{
+				{Frac: 6.0, TagText: string(config.DefaultColumnTag)},
+				{Frac: 4.0, TagText: string(config.DefaultColumnTag)},
+			},
+			Wd: root,
+		})
+		EditFind(root, ".", false, false)
+		if !DumpTo(dest) {
+			return
+		}
+	}
+
+	AutoDumpPath = dest
+	setDumpTitle()
+}
+
+func WorkspacesCmd(ec ExecContext, arg string) {
+	exitConfirmed = false
+
+	dh, err := os.Open(workspacesDir())
+	if err != nil {
+		Warn("Workspaces: no workspaces saved")
+		return
+	}
+	defer dh.Close()
+
+	var fis fileInfoSortByTime
+	fis, err = dh.Readdir(-1)
+	if err != nil {
+		fis = []os.FileInfo{}
+	}
+	sort.Sort(fis)
+
+	r := []string{}
+	for i := range fis {
+		n := fis[i].Name()
+		if !strings.HasSuffix(n, workspaceExt) {
+			continue
+		}
+		n = n[:len(n)-len(workspaceExt)]
+		if workspacePath(n) == AutoDumpPath {
+			r = append(r, fmt.Sprintf("Workspace %s\t(current)", n))
+		} else {
+			r = append(r, fmt.Sprintf("Workspace %s", n))
+		}
+	}
+
+	wd, _ := os.Getwd()
+	ed, err := EditFind(wd, "+Workspaces", false, true)
+	if err != nil {
+		Warn("Workspaces: " + err.Error())
+		return
+	}
+	ed.sfr.Fr.Sel = util.Sel{0, ed.bodybuf.Size()}
+	ed.bodybuf.Replace([]rune(strings.Join(r, "\n")+"\n"), &ed.sfr.Fr.Sel, true, nil, 0)
+	ed.sfr.Fr.Sel = util.Sel{0, 0}
+	ed.BufferRefresh()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"image"
 	"log"
 	"os"
@@ -14,6 +15,7 @@ import (
 	"github.com/aarzilli/yacco/clipboard"
 	"github.com/aarzilli/yacco/config"
 	"github.com/aarzilli/yacco/edit"
+	"github.com/aarzilli/yacco/headless"
 	"github.com/aarzilli/yacco/util"
 
 	"golang.org/x/exp/shiny/driver"
@@ -35,6 +37,8 @@ var acmeCompatFlag = flag.Bool("acme", false, "Uses acme file to listen")
 var cpuprofileFlag = flag.String("cpuprofile", "", "Write cpu profile to file")
 var memprofileFlag = flag.String("memprofile", "", "Write memory profile to file")
 var pprofServerFlag = flag.Bool("pprof", false, "Start pprof server")
+var clipboardFlag = flag.String("clipboard", "", "Clipboard backend to use (x11, memory, cmd)")
+var headlessFlag = flag.Bool("headless", false, "Runs without a window, only serving the 9p interface")
 
 var tagColors = [][]image.Uniform{
 	config.TheColorScheme.TagPlain,
@@ -49,6 +53,8 @@ var editorColors = [][]image.Uniform{
 	config.TheColorScheme.EditorSel2,                // 1 second button selection
 	config.TheColorScheme.EditorSel3,                // 2 third button selection
 	config.TheColorScheme.EditorMatchingParenthesis, // 3 matching parenthesis
+	// row 5: highlighted matches, the text colors of EditorPlain on the background of EditorSel3
+	highlightColors(config.TheColorScheme.EditorPlain, config.TheColorScheme.EditorSel3),
 }
 
 func setTheme(t string) {
@@ -69,6 +75,7 @@ func setTheme(t string) {
 	editorColors[2] = config.TheColorScheme.EditorSel2
 	editorColors[3] = config.TheColorScheme.EditorSel3
 	editorColors[4] = config.TheColorScheme.EditorMatchingParenthesis
+	editorColors[5] = highlightColors(editorColors[0], config.TheColorScheme.EditorSel3)
 
 	if Wnd.cols != nil {
 		for _, col := range Wnd.cols.cols {
@@ -156,6 +163,9 @@ func realmain(s screen.Screen) {
 	Wnd.tagbuf.Replace([]rune(startWinTag), &util.Sel{Wnd.tagbuf.Size(), Wnd.tagbuf.Size()}, true, nil, 0)
 	Wnd.BufferRefresh()
 
+	recoverList(true)
+	go autosaveLoop()
+
 	Wnd.FlushImage()
 
 	debug.FreeOSMemory()
@@ -170,12 +180,6 @@ func main() {
 			log.Println(http.ListenAndServe("localhost:6060", nil))
 		}()
 	}
-	config.LoadConfiguration(*configFlag)
-	config.LoadTemplates()
-	LoadInit()
-	KeysInit()
-	clipboard.Start()
-
 	if *cpuprofileFlag != "" {
 		f, err := os.Create(*cpuprofileFlag)
 		if err != nil {
@@ -185,7 +189,35 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	setup()
+
+	if *headlessFlag {
+		fmt.Printf("export yp9=%s\n", os.Getenv("yp9"))
+		realmain(headless.NewScreen())
+		return
+	}
+
+	driver.Main(realmain)
+}
+
+// Loads the configuration and starts the 9p server
+func setup() {
+	config.LoadConfiguration(*configFlag)
+	config.LoadTemplates()
+	if *headlessFlag && config.MainFont == nil {
+		face := headless.NewFace(8, 16)
+		config.MainFont, config.TagFont, config.AltFont, config.ComplFont = face, face, face, face
+		config.MainFontSize = 16
+	}
+	LoadInit()
+	HooksInit()
+	PlacementInit()
+	BookmarksInit()
+	KeysInit()
+	startClipboard()
+
 	edit.Warnfn = Warn
+	edit.Bookmarkfn = bookmarkAddr
 	edit.NewJob = func(wd, cmd, input string, buf *buf.Buffer, resultChan chan<- string) {
 		NewJob(wd, cmd, input, &ExecContext{buf: buf}, false, false, resultChan)
 	}
@@ -193,8 +225,27 @@ func main() {
 	sideChan = make(chan func(), 5)
 
 	FsInit()
+}
 
-	driver.Main(realmain)
+func startClipboard() {
+	name := config.ClipboardBackend
+	if *clipboardFlag != "" {
+		name = *clipboardFlag
+	} else if *headlessFlag && name == "" {
+		name = "memory"
+	}
+	if config.ClipboardCopyCmd != "" {
+		clipboard.CopyCmd = config.ClipboardCopyCmd
+	}
+	if config.ClipboardPasteCmd != "" {
+		clipboard.PasteCmd = config.ClipboardPasteCmd
+	}
+	if config.ClipboardPastePrimaryCmd != "" {
+		clipboard.PastePrimaryCmd = config.ClipboardPastePrimaryCmd
+	}
+	if err := clipboard.Start(name); err != nil {
+		log.Fatalf("Could not start clipboard: %v", err)
+	}
 }
 
 func removeBuffer(b *buf.Buffer) {